@@ -4,7 +4,6 @@ import (
 	"crypto/rand"
 	"encoding/base32"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -13,12 +12,16 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/husio/x/cache"
+	"github.com/husio/x/log"
 	"github.com/husio/x/storage/pg"
 	"github.com/husio/x/web"
 )
 
 const stateCookie = "oauthState"
 
+// stateTTL is the time user has to complete login process.
+const stateTTL = 15 * time.Minute
+
 func WithOAuth(ctx context.Context, conf map[string]*oauth2.Config) context.Context {
 	return context.WithValue(ctx, "auth:oauth", conf)
 }
@@ -36,7 +39,7 @@ func LoginHandler(provider string) web.HandlerFunc {
 	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		conf, ok := oauth(ctx, provider)
 		if !ok {
-			log.Printf("missing oauth provider configuration: %s", provider)
+			log.FromContext(ctx).Error("missing oauth provider configuration", "provider", provider)
 			const code = http.StatusInternalServerError
 			http.Error(w, http.StatusText(code), code)
 			return
@@ -48,20 +51,20 @@ func LoginHandler(provider string) web.HandlerFunc {
 			Name:    stateCookie,
 			Path:    "/",
 			Value:   state,
-			Expires: time.Now().Add(time.Minute * 15),
+			Expires: time.Now().Add(stateTTL),
 		})
 
 		nextURL := r.URL.Query().Get("next")
 		if nextURL == "" {
 			nextURL = "/"
 		}
-		err := cache.Get(ctx).Put("auth:"+state, &authData{
+		err := cache.Get(ctx).PutTTL("auth:"+state, &authData{
 			Provider: provider,
 			Scopes:   conf.Scopes,
 			NextURL:  nextURL,
-		})
+		}, stateTTL)
 		if err != nil {
-			log.Printf("cannot store in cache: %s", err)
+			log.FromContext(ctx).Error("cannot store in cache", log.Err(err))
 			web.StdJSONResp(w, http.StatusInternalServerError)
 			return
 		}
@@ -78,7 +81,7 @@ type authData struct {
 func HandleLoginCallback(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	var state string
 	if c, err := r.Cookie(stateCookie); err != nil || c.Value == "" {
-		log.Printf("invalid oauth state: expected %q, got %q", state, r.FormValue("state"))
+		log.FromContext(ctx).Warn("invalid oauth state", "expected", state, "got", r.FormValue("state"))
 		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
 		return
 	} else {
@@ -86,7 +89,7 @@ func HandleLoginCallback(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 
 	if r.FormValue("state") != state {
-		log.Printf("invalid oauth state: expected %q, got %q", state, r.FormValue("state"))
+		log.FromContext(ctx).Warn("invalid oauth state", "expected", state, "got", r.FormValue("state"))
 		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -99,14 +102,31 @@ func HandleLoginCallback(ctx context.Context, w http.ResponseWriter, r *http.Req
 		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
 		return
 	default:
-		log.Printf("cannot get auth data from cache: %s", err)
+		log.FromContext(ctx).Error("cannot get auth data from cache", log.Err(err))
+		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	// state can be used only once, even if the callback is called
+	// concurrently
+	switch err := cache.Get(ctx).Add("auth:used:"+state, true, stateTTL); err {
+	case nil:
+		if err := cache.Get(ctx).Del("auth:" + state); err != nil {
+			log.FromContext(ctx).Error("cannot delete auth data from cache", log.Err(err))
+		}
+	case cache.ErrConflict:
+		log.FromContext(ctx).Warn("oauth state already used", "state", state)
+		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
+		return
+	default:
+		log.FromContext(ctx).Error("cannot mark oauth state as used", log.Err(err))
 		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	conf, ok := oauth(ctx, data.Provider)
 	if !ok {
-		log.Printf("missing oauth provider configuration: %#v", data)
+		log.FromContext(ctx).Error("missing oauth provider configuration", "provider", data.Provider)
 		const code = http.StatusInternalServerError
 		http.Error(w, http.StatusText(code), code)
 		return
@@ -114,14 +134,14 @@ func HandleLoginCallback(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 	token, err := conf.Exchange(oauth2.NoContext, r.FormValue("code"))
 	if err != nil {
-		log.Printf("oauth exchange failed: %s", err)
+		log.FromContext(ctx).Error("oauth exchange failed", log.Err(err))
 		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
 		return
 	}
 	cli := google.NewClient(conf.Client(oauth2.NoContext, token))
 	user, _, err := cli.Users.Get("")
 	if err != nil {
-		log.Printf("cannot get user: %s", err)
+		log.FromContext(ctx).Error("cannot get user", log.Err(err))
 		web.JSONRedirect(w, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -129,7 +149,7 @@ func HandleLoginCallback(ctx context.Context, w http.ResponseWriter, r *http.Req
 	db := pg.DB(ctx)
 	tx, err := db.Beginx()
 	if err != nil {
-		log.Printf("cannot start transaction: %s", err)
+		log.FromContext(ctx).Error("cannot start transaction", log.Err(err))
 		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		return
 	}
@@ -139,27 +159,27 @@ func HandleLoginCallback(ctx context.Context, w http.ResponseWriter, r *http.Req
 	acc, err := AccountByLogin(tx, *user.Login, provider)
 	if err != nil {
 		if err != pg.ErrNotFound {
-			log.Printf("cannot get account %s: %s", *user.Login, err)
+			log.FromContext(ctx).Error("cannot get account", "login", *user.Login, log.Err(err))
 			http.Error(w, "cannot authenticate", http.StatusInternalServerError)
 			return
 		}
 
 		acc, err = CreateAccount(tx, *user.ID, *user.Login, provider)
 		if err != nil {
-			log.Printf("cannot create account for %v: %s", user, err)
+			log.FromContext(ctx).Error("cannot create account", "login", *user.Login, log.Err(err))
 			http.Error(w, "cannot create account", http.StatusInternalServerError)
 			return
 		}
 	}
 
 	if err := authenticate(tx, w, acc.AccountID, token.AccessToken, data.Scopes); err != nil {
-		log.Printf("cannot authenticate %#v: %s", acc, err)
+		log.FromContext(ctx).Error("cannot authenticate", "account", acc.AccountID, log.Err(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
 	if err := tx.Commit(); err != nil {
-		log.Printf("cannot commit transaction: %s", err)
+		log.FromContext(ctx).Error("cannot commit transaction", log.Err(err))
 		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		return
 	}
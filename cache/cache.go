@@ -2,24 +2,99 @@ package cache
 
 import (
 	"errors"
+	"time"
 
 	"golang.org/x/net/context"
 )
 
-var ErrNotFound = errors.New("not found")
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrTooLarge   = errors.New("value too large")
+	ErrNotInteger = errors.New("value is not an integer")
+	// ErrInvalidPrefix is returned by DelPrefix of remote implementations
+	// if prefix does not end with ':' separator.
+	ErrInvalidPrefix = errors.New("prefix must end with ':'")
+	// ErrNotSupported is returned by operations that are not enabled by
+	// the cache configuration.
+	ErrNotSupported = errors.New("operation not supported")
+)
 
 const contextKey = "cache"
 
 type Cache interface {
+	// Get load value stored under given key into dest. ErrNotFound is
+	// returned if value does not exist or is expired.
 	Get(key string, dest interface{}) error
+	// Put store value under given key. Value never expires.
 	Put(key string, src interface{}) error
+	// PutTTL store value under given key. Value expires after given time.
+	// Zero ttl means no expiration.
+	PutTTL(key string, src interface{}, ttl time.Duration) error
+	// Del remove value stored under given key.
 	Del(key string) error
+
+	// Add store value only if given key does not exist yet. ErrConflict is
+	// returned otherwise.
+	Add(key string, src interface{}, ttl time.Duration) error
+	// Replace store value only if given key already exists. ErrNotFound is
+	// returned otherwise.
+	Replace(key string, src interface{}, ttl time.Duration) error
+	// GetVersion works like Get, but additionally return version of the
+	// value, that can be used by CompareAndSwap.
+	GetVersion(key string, dest interface{}) (uint64, error)
+	// CompareAndSwap store value only if version of currently stored value
+	// is as given. ErrConflict is returned if value was modified and
+	// ErrNotFound if it does not exist anymore.
+	CompareAndSwap(key string, src interface{}, version uint64, ttl time.Duration) error
+	// Incr increment integer value stored under given key by delta and
+	// return the result. If value does not exist, it is created with zero
+	// as initial value and no expiration. ErrNotInteger is returned if
+	// stored value is not an integer.
+	Incr(key string, delta int64) (int64, error)
+	// Decr decrement integer value stored under given key by delta and
+	// return the result. See Incr.
+	Decr(key string, delta int64) (int64, error)
+
+	// PutTagged works like PutTTL, but additionally attach given tags to
+	// the value. All values with the same tag can be removed at once using
+	// InvalidateTag.
+	PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) error
+	// InvalidateTag remove all values tagged with given tag.
+	InvalidateTag(tag string) error
+	// DelPrefix remove all values with key starting with given prefix.
+	// Remote implementations require prefix to end with ':' separator, for
+	// example "account:42:", and return ErrInvalidPrefix otherwise.
+	DelPrefix(prefix string) error
 }
 
+// WithCache return context carrying given cache instance. Use From or Get to
+// retrieve it back.
+func WithCache(ctx context.Context, c Cache) context.Context {
+	return context.WithValue(ctx, contextKey, c)
+}
+
+// Get return cache instance carried by given context. It panics if context
+// does not carry any cache, use From to check its presence.
 func Get(ctx context.Context) Cache {
-	c := ctx.Value(contextKey)
-	if c == nil {
+	c, ok := From(ctx)
+	if !ok {
 		panic("cache not present in context")
 	}
-	return c.(Cache)
+	return c
+}
+
+// Stats describes cache usage. Cache implementations that are tracking their
+// usage provide it by Stats() method.
+type Stats struct {
+	// Bytes is estimated memory used by all entries.
+	Bytes int64
+	// Entries is the number of stored entries.
+	Entries int
+	// Hits is the number of successful lookups.
+	Hits uint64
+	// Misses is the number of lookups for missing or expired entries.
+	Misses uint64
+	// Evictions is the number of entries removed to make space for new ones.
+	Evictions uint64
 }
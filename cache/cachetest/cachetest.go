@@ -0,0 +1,174 @@
+// Package cachetest provides cache implementations useful for testing.
+package cachetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/husio/x/cache"
+)
+
+// Noop is cache that does not store anything. Get always return
+// cache.ErrNotFound and all writes succeed.
+type Noop struct{}
+
+var _ cache.Cache = Noop{}
+
+func (Noop) Get(string, interface{}) error {
+	return cache.ErrNotFound
+}
+
+func (Noop) GetVersion(string, interface{}) (uint64, error) {
+	return 0, cache.ErrNotFound
+}
+
+func (Noop) Put(string, interface{}) error {
+	return nil
+}
+
+func (Noop) PutTTL(string, interface{}, time.Duration) error {
+	return nil
+}
+
+func (Noop) PutTagged(string, interface{}, time.Duration, ...string) error {
+	return nil
+}
+
+func (Noop) Add(string, interface{}, time.Duration) error {
+	return nil
+}
+
+func (Noop) Replace(string, interface{}, time.Duration) error {
+	return cache.ErrNotFound
+}
+
+func (Noop) CompareAndSwap(string, interface{}, uint64, time.Duration) error {
+	return cache.ErrNotFound
+}
+
+// Incr return delta, as if counter was always created.
+func (Noop) Incr(key string, delta int64) (int64, error) {
+	return delta, nil
+}
+
+// Decr return negative delta, as if counter was always created.
+func (Noop) Decr(key string, delta int64) (int64, error) {
+	return -delta, nil
+}
+
+func (Noop) Del(string) error {
+	return nil
+}
+
+func (Noop) InvalidateTag(string) error {
+	return nil
+}
+
+func (Noop) DelPrefix(string) error {
+	return nil
+}
+
+// Call describes single cache operation.
+type Call struct {
+	// Op is the name of called method, for example "Get" or "PutTTL".
+	Op string
+	// Key is the key, tag or prefix operation was called with.
+	Key string
+	// Err is the error returned by the operation.
+	Err error
+}
+
+// Recorder is cache that record all operations before passing them to
+// wrapped cache.
+type Recorder struct {
+	c cache.Cache
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ cache.Cache = (*Recorder)(nil)
+
+// NewRecorder return recorder wrapping given cache. Use Noop to only record
+// calls.
+func NewRecorder(c cache.Cache) *Recorder {
+	return &Recorder{c: c}
+}
+
+// Calls return all recorded operations, in the order they were called.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]Call, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// Reset remove all recorded operations.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.calls = nil
+	r.mu.Unlock()
+}
+
+func (r *Recorder) record(op, key string, err error) error {
+	r.mu.Lock()
+	r.calls = append(r.calls, Call{Op: op, Key: key, Err: err})
+	r.mu.Unlock()
+	return err
+}
+
+func (r *Recorder) Get(key string, dest interface{}) error {
+	return r.record("Get", key, r.c.Get(key, dest))
+}
+
+func (r *Recorder) GetVersion(key string, dest interface{}) (uint64, error) {
+	version, err := r.c.GetVersion(key, dest)
+	return version, r.record("GetVersion", key, err)
+}
+
+func (r *Recorder) Put(key string, src interface{}) error {
+	return r.record("Put", key, r.c.Put(key, src))
+}
+
+func (r *Recorder) PutTTL(key string, src interface{}, ttl time.Duration) error {
+	return r.record("PutTTL", key, r.c.PutTTL(key, src, ttl))
+}
+
+func (r *Recorder) PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) error {
+	return r.record("PutTagged", key, r.c.PutTagged(key, src, ttl, tags...))
+}
+
+func (r *Recorder) Add(key string, src interface{}, ttl time.Duration) error {
+	return r.record("Add", key, r.c.Add(key, src, ttl))
+}
+
+func (r *Recorder) Replace(key string, src interface{}, ttl time.Duration) error {
+	return r.record("Replace", key, r.c.Replace(key, src, ttl))
+}
+
+func (r *Recorder) CompareAndSwap(key string, src interface{}, version uint64, ttl time.Duration) error {
+	return r.record("CompareAndSwap", key, r.c.CompareAndSwap(key, src, version, ttl))
+}
+
+func (r *Recorder) Incr(key string, delta int64) (int64, error) {
+	n, err := r.c.Incr(key, delta)
+	return n, r.record("Incr", key, err)
+}
+
+func (r *Recorder) Decr(key string, delta int64) (int64, error) {
+	n, err := r.c.Decr(key, delta)
+	return n, r.record("Decr", key, err)
+}
+
+func (r *Recorder) Del(key string) error {
+	return r.record("Del", key, r.c.Del(key))
+}
+
+func (r *Recorder) InvalidateTag(tag string) error {
+	return r.record("InvalidateTag", tag, r.c.InvalidateTag(tag))
+}
+
+func (r *Recorder) DelPrefix(prefix string) error {
+	return r.record("DelPrefix", prefix, r.c.DelPrefix(prefix))
+}
@@ -0,0 +1,52 @@
+package cachetest
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+)
+
+func TestNoop(t *testing.T) {
+	var c Noop
+	if err := c.Put("a", 1); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	var val int
+	if err := c.Get("a", &val); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if n, err := c.Incr("n", 3); err != nil || n != 3 {
+		t.Errorf("want 3, got %d, %v", n, err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := cache.WithLocalCache(context.Background(), 10)
+	r := NewRecorder(cache.Get(ctx))
+
+	var val int
+	r.Get("a", &val)
+	r.Put("a", 1)
+	r.Get("a", &val)
+	r.InvalidateTag("t")
+	if val != 1 {
+		t.Errorf("want 1, got %d", val)
+	}
+
+	want := []Call{
+		{Op: "Get", Key: "a", Err: cache.ErrNotFound},
+		{Op: "Put", Key: "a"},
+		{Op: "Get", Key: "a"},
+		{Op: "InvalidateTag", Key: "t"},
+	}
+	if got := r.Calls(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+	r.Reset()
+	if got := r.Calls(); len(got) != 0 {
+		t.Errorf("want no calls, got %+v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Codec serialize values stored in the cache.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON codec is using encoding/json. This is the default codec.
+	JSON Codec = jsonCodec{}
+	// Gob codec is using encoding/gob. It preserves more type information
+	// than JSON, but every value carries its type description, which makes
+	// small values bigger.
+	Gob Codec = gobCodec{}
+	// Raw codec store []byte values as they are. Only []byte and *[]byte
+	// can be stored and values can be loaded only into *[]byte. Raw codec
+	// cannot be used for counters.
+	Raw Codec = rawCodec{}
+)
+
+// codecOf return codec used by given cache to serialize values. Caches
+// expose their codec with Codec method. JSON is returned for caches that do
+// not.
+func codecOf(c interface{}) Codec {
+	for {
+		if cc, ok := c.(interface {
+			Codec() Codec
+		}); ok {
+			return cc.Codec()
+		}
+		switch cc := c.(type) {
+		case bound:
+			c = cc.c
+		case contextual:
+			c = cc.c
+		case Unwrapper:
+			p := cc.Unwrap()
+			if p == nil {
+				return JSON
+			}
+			c = p
+		default:
+			return JSON
+		}
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	// value is copied, so that stored data does not change when caller
+	// modifies the slice
+	switch b := v.(type) {
+	case []byte:
+		return append([]byte(nil), b...), nil
+	case *[]byte:
+		return append([]byte(nil), *b...), nil
+	default:
+		return nil, fmt.Errorf("raw codec cannot marshal %T", v)
+	}
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Compress return codec that compress serialized values bigger than given
+// number of bytes. Values written by compressing codec can be read only by
+// compressing codec.
+func Compress(c Codec, threshold int) Codec {
+	return &compressCodec{codec: c, threshold: threshold}
+}
+
+type compressCodec struct {
+	codec     Codec
+	threshold int
+}
+
+// first byte of the data written by compressing codec describes how the rest
+// is encoded
+const (
+	plain      byte = 0
+	compressed byte = 1
+)
+
+var errCorrupted = errors.New("corrupted compressed data")
+
+func (c *compressCodec) Marshal(v interface{}) ([]byte, error) {
+	raw, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) <= c.threshold {
+		return append([]byte{plain}, raw...), nil
+	}
+
+	var b bytes.Buffer
+	b.WriteByte(compressed)
+	w, err := flate.NewWriter(&b, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c *compressCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return errCorrupted
+	}
+	switch data[0] {
+	case plain:
+		return c.codec.Unmarshal(data[1:], v)
+	case compressed:
+		r := flate.NewReader(bytes.NewReader(data[1:]))
+		raw, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return c.codec.Unmarshal(raw, v)
+	default:
+		return errCorrupted
+	}
+}
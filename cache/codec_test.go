@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type codecEntity struct {
+	Name    string
+	Created time.Time
+	Big     int64
+	Data    []byte
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	loc := time.FixedZone("X", 3*60*60)
+	src := codecEntity{
+		Name:    "bob",
+		Created: time.Date(2016, 3, 4, 5, 6, 7, 8, loc),
+		Big:     1<<62 + 1,
+		Data:    []byte{0, 1, 2},
+	}
+	codecs := map[string]Codec{
+		"json":          JSON,
+		"gob":           Gob,
+		"compress json": Compress(JSON, 0),
+		"compress gob":  Compress(Gob, 10000),
+	}
+	for name, codec := range codecs {
+		raw, err := codec.Marshal(&src)
+		if err != nil {
+			t.Errorf("%s: cannot marshal: %s", name, err)
+			continue
+		}
+		var dest codecEntity
+		if err := codec.Unmarshal(raw, &dest); err != nil {
+			t.Errorf("%s: cannot unmarshal: %s", name, err)
+			continue
+		}
+		if dest.Name != src.Name || dest.Big != src.Big || !bytes.Equal(dest.Data, src.Data) {
+			t.Errorf("%s: want %+v, got %+v", name, src, dest)
+		}
+		if !dest.Created.Equal(src.Created) {
+			t.Errorf("%s: want %s, got %s", name, src.Created, dest.Created)
+		}
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	raw, err := Raw.Marshal([]byte("abc"))
+	if err != nil || string(raw) != "abc" {
+		t.Fatalf("want abc, got %q, %v", raw, err)
+	}
+	var dest []byte
+	if err := Raw.Unmarshal(raw, &dest); err != nil || string(dest) != "abc" {
+		t.Fatalf("want abc, got %q, %v", dest, err)
+	}
+	if _, err := Raw.Marshal("abc"); err == nil {
+		t.Error("want error for string")
+	}
+	var s string
+	if err := Raw.Unmarshal(raw, &s); err == nil {
+		t.Error("want error for *string")
+	}
+}
+
+func TestRawCodecCopy(t *testing.T) {
+	c := newLocalCache(10)
+	c.codec = Raw
+
+	value := []byte("abc")
+	must(c.Put("a", value))
+	must(c.Put("b", &value))
+	value[0] = 'x'
+
+	for _, key := range []string{"a", "b"} {
+		var got []byte
+		must(c.Get(key, &got))
+		if string(got) != "abc" {
+			t.Errorf("%s: want abc, got %q", key, got)
+		}
+	}
+}
+
+func TestCompressCodec(t *testing.T) {
+	codec := Compress(Raw, 100)
+
+	small, err := codec.Marshal([]byte("small"))
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	if small[0] != plain || string(small[1:]) != "small" {
+		t.Errorf("want plain value, got %q", small)
+	}
+
+	value := []byte(strings.Repeat("compress me ", 1000))
+	big, err := codec.Marshal(value)
+	if err != nil {
+		t.Fatalf("cannot marshal: %s", err)
+	}
+	if big[0] != compressed || len(big) > len(value)/10 {
+		t.Errorf("want compressed value, got %d bytes", len(big))
+	}
+	var dest []byte
+	if err := codec.Unmarshal(big, &dest); err != nil || !bytes.Equal(dest, value) {
+		t.Errorf("cannot unmarshal: %v", err)
+	}
+
+	if err := codec.Unmarshal([]byte{7, 1, 2}, &dest); err != errCorrupted {
+		t.Errorf("want errCorrupted, got %v", err)
+	}
+	if err := codec.Unmarshal(nil, &dest); err != errCorrupted {
+		t.Errorf("want errCorrupted, got %v", err)
+	}
+}
+
+func TestLocalCacheCodec(t *testing.T) {
+	ctx, done := context.WithCancel(context.Background())
+	defer done()
+	c := Get(WithLocalCacheOpts(ctx, &LocalOpts{MaxSize: 10, Codec: Gob}))
+
+	created := time.Date(2016, 3, 4, 5, 6, 7, 8, time.FixedZone("X", 3600))
+	must(c.Put("a", codecEntity{Name: "a", Created: created}))
+	var e codecEntity
+	must(c.Get("a", &e))
+	if _, offset := e.Created.Zone(); offset != 3600 {
+		t.Errorf("want zone preserved, got %s", e.Created)
+	}
+
+	if n, err := c.Incr("n", 3); err != nil || n != 3 {
+		t.Fatalf("want 3, got %d, %v", n, err)
+	}
+	var n int64
+	must(c.Get("n", &n))
+	if n != 3 {
+		t.Errorf("want 3, got %d", n)
+	}
+	if _, err := c.Incr("a", 1); err != ErrNotInteger {
+		t.Errorf("want ErrNotInteger, got %v", err)
+	}
+
+	// codec errors are returned
+	if err := c.Put("b", make(chan int)); err == nil {
+		t.Error("want marshal error")
+	}
+	var s string
+	if err := c.Get("a", &s); err == nil {
+		t.Error("want unmarshal error")
+	}
+}
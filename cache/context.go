@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ContextCache is the context aware variant of Cache. Every operation is
+// bound to given context and fails if context is done. Remote
+// implementations are not waiting for the response longer than context
+// deadline.
+type ContextCache interface {
+	Get(ctx context.Context, key string, dest interface{}) error
+	Put(ctx context.Context, key string, src interface{}) error
+	PutTTL(ctx context.Context, key string, src interface{}, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+	Add(ctx context.Context, key string, src interface{}, ttl time.Duration) error
+	Replace(ctx context.Context, key string, src interface{}, ttl time.Duration) error
+	GetVersion(ctx context.Context, key string, dest interface{}) (uint64, error)
+	CompareAndSwap(ctx context.Context, key string, src interface{}, version uint64, ttl time.Duration) error
+	Incr(ctx context.Context, key string, delta int64) (int64, error)
+	Decr(ctx context.Context, key string, delta int64) (int64, error)
+	PutTagged(ctx context.Context, key string, src interface{}, ttl time.Duration, tags ...string) error
+	InvalidateTag(ctx context.Context, tag string) error
+	DelPrefix(ctx context.Context, prefix string) error
+}
+
+// ContextBinder is implemented by caches that can limit their operations by
+// context deadline.
+type ContextBinder interface {
+	// WithContext return cache executing all operations within given
+	// context.
+	WithContext(ctx context.Context) Cache
+}
+
+// Unwrapper is implemented by caches that are a view of another cache
+// instance, for example bound to a context by ContextBinder. Caches
+// unwrapping to the same instance are considered the same cache, so that for
+// example concurrent GetOrLoad calls are deduplicated.
+type Unwrapper interface {
+	// Unwrap return the wrapped cache or nil if cache is not wrapping any.
+	Unwrap() Cache
+}
+
+// identity return value identifying the cache instance, ignoring all
+// wrappers binding it to a context.
+func identity(c interface{}) interface{} {
+	for {
+		switch cc := c.(type) {
+		case bound:
+			c = cc.c
+		case contextual:
+			c = cc.c
+		case Unwrapper:
+			p := cc.Unwrap()
+			if p == nil {
+				return c
+			}
+			c = p
+		default:
+			return c
+		}
+	}
+}
+
+// WithContextCache return context carrying given cache instance. Use From or
+// ContextFrom to retrieve it back.
+func WithContextCache(ctx context.Context, c ContextCache) context.Context {
+	return context.WithValue(ctx, contextKey, c)
+}
+
+// From return cache instance carried by given context. Cache is returned
+// bound to given context, see Bind and ContextBinder.
+func From(ctx context.Context) (Cache, bool) {
+	switch c := ctx.Value(contextKey).(type) {
+	case Cache:
+		return bind(ctx, c), true
+	case ContextCache:
+		return Bind(ctx, c), true
+	default:
+		return nil, false
+	}
+}
+
+// ContextFrom return context aware cache instance carried by given context.
+func ContextFrom(ctx context.Context) (ContextCache, bool) {
+	switch c := ctx.Value(contextKey).(type) {
+	case Cache:
+		return Contextual(c), true
+	case ContextCache:
+		return c, true
+	default:
+		return nil, false
+	}
+}
+
+func bind(ctx context.Context, c Cache) Cache {
+	if b, ok := c.(ContextBinder); ok {
+		return b.WithContext(ctx)
+	}
+	return c
+}
+
+// Contextual return context aware adapter of given cache. Context deadline is
+// honored only if cache implements ContextBinder, otherwise context is
+// checked only before calling the cache.
+func Contextual(c Cache) ContextCache {
+	return contextual{c: c}
+}
+
+type contextual struct {
+	c Cache
+}
+
+// bind return cache bound to given context, or an error if context is done.
+func (cc contextual) bind(ctx context.Context) (Cache, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return bind(ctx, cc.c), nil
+}
+
+func (cc contextual) Get(ctx context.Context, key string, dest interface{}) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Get(key, dest)
+}
+
+func (cc contextual) Put(ctx context.Context, key string, src interface{}) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Put(key, src)
+}
+
+func (cc contextual) PutTTL(ctx context.Context, key string, src interface{}, ttl time.Duration) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.PutTTL(key, src, ttl)
+}
+
+func (cc contextual) Del(ctx context.Context, key string) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Del(key)
+}
+
+func (cc contextual) Add(ctx context.Context, key string, src interface{}, ttl time.Duration) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Add(key, src, ttl)
+}
+
+func (cc contextual) Replace(ctx context.Context, key string, src interface{}, ttl time.Duration) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Replace(key, src, ttl)
+}
+
+func (cc contextual) GetVersion(ctx context.Context, key string, dest interface{}) (uint64, error) {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.GetVersion(key, dest)
+}
+
+func (cc contextual) CompareAndSwap(ctx context.Context, key string, src interface{}, version uint64, ttl time.Duration) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.CompareAndSwap(key, src, version, ttl)
+}
+
+func (cc contextual) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.Incr(key, delta)
+}
+
+func (cc contextual) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.Decr(key, delta)
+}
+
+func (cc contextual) PutTagged(ctx context.Context, key string, src interface{}, ttl time.Duration, tags ...string) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.PutTagged(key, src, ttl, tags...)
+}
+
+func (cc contextual) InvalidateTag(ctx context.Context, tag string) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.InvalidateTag(tag)
+}
+
+func (cc contextual) DelPrefix(ctx context.Context, prefix string) error {
+	c, err := cc.bind(ctx)
+	if err != nil {
+		return err
+	}
+	return c.DelPrefix(prefix)
+}
+
+// Bind return adapter of context aware cache, that is using given context for
+// all operations. It allows to pass ContextCache to the code expecting Cache.
+func Bind(ctx context.Context, c ContextCache) Cache {
+	return bound{ctx: ctx, c: c}
+}
+
+type bound struct {
+	ctx context.Context
+	c   ContextCache
+}
+
+func (b bound) Get(key string, dest interface{}) error {
+	return b.c.Get(b.ctx, key, dest)
+}
+
+func (b bound) Put(key string, src interface{}) error {
+	return b.c.Put(b.ctx, key, src)
+}
+
+func (b bound) PutTTL(key string, src interface{}, ttl time.Duration) error {
+	return b.c.PutTTL(b.ctx, key, src, ttl)
+}
+
+func (b bound) Del(key string) error {
+	return b.c.Del(b.ctx, key)
+}
+
+func (b bound) Add(key string, src interface{}, ttl time.Duration) error {
+	return b.c.Add(b.ctx, key, src, ttl)
+}
+
+func (b bound) Replace(key string, src interface{}, ttl time.Duration) error {
+	return b.c.Replace(b.ctx, key, src, ttl)
+}
+
+func (b bound) GetVersion(key string, dest interface{}) (uint64, error) {
+	return b.c.GetVersion(b.ctx, key, dest)
+}
+
+func (b bound) CompareAndSwap(key string, src interface{}, version uint64, ttl time.Duration) error {
+	return b.c.CompareAndSwap(b.ctx, key, src, version, ttl)
+}
+
+func (b bound) Incr(key string, delta int64) (int64, error) {
+	return b.c.Incr(b.ctx, key, delta)
+}
+
+func (b bound) Decr(key string, delta int64) (int64, error) {
+	return b.c.Decr(b.ctx, key, delta)
+}
+
+func (b bound) PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) error {
+	return b.c.PutTagged(b.ctx, key, src, ttl, tags...)
+}
+
+func (b bound) InvalidateTag(tag string) error {
+	return b.c.InvalidateTag(b.ctx, tag)
+}
+
+func (b bound) DelPrefix(prefix string) error {
+	return b.c.DelPrefix(b.ctx, prefix)
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestFrom(t *testing.T) {
+	if _, ok := From(context.Background()); ok {
+		t.Error("want no cache")
+	}
+	if _, ok := ContextFrom(context.Background()); ok {
+		t.Error("want no cache")
+	}
+
+	ctx := WithLocalCache(context.Background(), 10)
+	c, ok := From(ctx)
+	if !ok {
+		t.Fatal("want cache")
+	}
+	if c != Get(ctx) {
+		t.Error("want the same instance")
+	}
+	cc, ok := ContextFrom(ctx)
+	if !ok {
+		t.Fatal("want context cache")
+	}
+	must(cc.Put(ctx, "a", 1))
+	var val int
+	must(c.Get("a", &val))
+	if val != 1 {
+		t.Errorf("want 1, got %d", val)
+	}
+
+	ctx = WithContextCache(context.Background(), cc)
+	c, ok = From(ctx)
+	if !ok {
+		t.Fatal("want cache")
+	}
+	must(c.Get("a", &val))
+	if val != 1 {
+		t.Errorf("want 1, got %d", val)
+	}
+}
+
+func TestGetPanicsWithoutCache(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic")
+		}
+	}()
+	Get(context.Background())
+}
+
+func TestContextualCanceled(t *testing.T) {
+	c := newLocalCache(10)
+	must(c.Put("a", 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cc := Contextual(c)
+	var val int
+	if err := cc.Get(ctx, "a", &val); err != nil || val != 1 {
+		t.Fatalf("want 1, got %d, %v", val, err)
+	}
+	cancel()
+	if err := cc.Get(ctx, "a", &val); err != context.Canceled {
+		t.Errorf("want Canceled, got %v", err)
+	}
+	if err := Bind(ctx, cc).Put("a", 2); err != context.Canceled {
+		t.Errorf("want Canceled, got %v", err)
+	}
+	if _, err := cc.Incr(ctx, "n", 1); err != context.Canceled {
+		t.Errorf("want Canceled, got %v", err)
+	}
+}
+
+// binderCache is recording the context it was bound to.
+type binderCache struct {
+	Cache
+	ctx context.Context
+}
+
+func (b *binderCache) WithContext(ctx context.Context) Cache {
+	return &binderCache{Cache: b.Cache, ctx: ctx}
+}
+
+func TestFromBindsCache(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	ctx := WithCache(context.Background(), &binderCache{Cache: newLocalCache(10)})
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	c, ok := From(ctx)
+	if !ok {
+		t.Fatal("want cache")
+	}
+	b, ok := c.(*binderCache)
+	if !ok || b.ctx == nil {
+		t.Fatalf("want cache bound to context, got %#v", c)
+	}
+	if d, ok := b.ctx.Deadline(); !ok || !d.Equal(deadline) {
+		t.Errorf("want %s deadline, got %s", deadline, d)
+	}
+}
@@ -0,0 +1,164 @@
+// Package gens helps remote cache implementations to emulate tag and prefix
+// invalidation using generation counters.
+//
+// Every tag and, if prefix invalidation is enabled, every key prefix ending
+// with ':' separator has its own counter, that is incremented to invalidate
+// all entries it covers. Value is
+// stored together with generations of all its counters at the time of
+// writing and is considered missing if any of the counters changed since.
+//
+// Integer values stored without tags are counters, that the server can
+// increment. They are not covered by prefix counters and are stored as
+// decimal text, without the envelope.
+package gens
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// TagKey return name of the counter for given tag.
+func TagKey(tag string) string {
+	return tagKeyPrefix + tag
+}
+
+const tagKeyPrefix = "~gen:t:"
+
+// Tags return tags of the tag counters among given counter names.
+func Tags(keys []string) []string {
+	var tags []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, tagKeyPrefix) {
+			tags = append(tags, key[len(tagKeyPrefix):])
+		}
+	}
+	return tags
+}
+
+// PrefixKey return name of the counter for given prefix.
+func PrefixKey(prefix string) string {
+	return "~gen:p:" + prefix
+}
+
+// Keys return names of all counters covering entry with given key and tags.
+// Prefix counters are included only if prefixes is true.
+func Keys(key string, tags []string, prefixes bool) []string {
+	var keys []string
+	for i := 0; prefixes && i < len(key); i++ {
+		if key[i] == ':' {
+			keys = append(keys, PrefixKey(key[:i+1]))
+		}
+	}
+	for _, tag := range tags {
+		keys = append(keys, TagKey(tag))
+	}
+	return keys
+}
+
+// IsCounter return true if value is a decimal integer, that can be modified
+// by the server.
+func IsCounter(value []byte) bool {
+	if len(value) > 0 && value[0] == '-' {
+		value = value[1:]
+	}
+	if len(value) == 0 {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// magic is the first byte of every envelope. Values that do not start with it
+// are counters, that are stored as decimal text.
+const magic = 0xff
+
+var ErrMalformed = errors.New("malformed envelope")
+
+// Encode return envelope containing value and generations of given counters.
+// Value not covered by any counter is returned as it is, unless it could be
+// mistaken for an envelope.
+func Encode(value []byte, keys []string, gens []int64) []byte {
+	if len(keys) == 0 && (len(value) == 0 || value[0] != magic) {
+		return value
+	}
+	b := make([]byte, 1, len(value)+64)
+	b[0] = magic
+	b = appendUvarint(b, uint64(len(keys)))
+	for i, key := range keys {
+		b = appendUvarint(b, uint64(len(key)))
+		b = append(b, key...)
+		b = appendVarint(b, gens[i])
+	}
+	return append(b, value...)
+}
+
+// Decode return value and counter generations stored in the envelope. Data
+// that is not an envelope is returned as value with no counters.
+func Decode(data []byte) (value []byte, keys []string, gens []int64, err error) {
+	if len(data) == 0 || data[0] != magic {
+		return data, nil, nil, nil
+	}
+	data = data[1:]
+	n, err := readUvarint(&data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if n > uint64(len(data)) {
+		return nil, nil, nil, ErrMalformed
+	}
+	keys = make([]string, n)
+	gens = make([]int64, n)
+	for i := range keys {
+		size, err := readUvarint(&data)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if size > uint64(len(data)) {
+			return nil, nil, nil, ErrMalformed
+		}
+		keys[i] = string(data[:size])
+		data = data[size:]
+		gen, m := binary.Varint(data)
+		if m <= 0 {
+			return nil, nil, nil, ErrMalformed
+		}
+		gens[i] = gen
+		data = data[m:]
+	}
+	return data, keys, gens, nil
+}
+
+// Valid return true if stored generations are equal to current ones. Counter
+// missing in current is zero.
+func Valid(keys []string, gens []int64, current map[string]int64) bool {
+	for i, key := range keys {
+		if current[key] != gens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+func readUvarint(data *[]byte) (uint64, error) {
+	v, n := binary.Uvarint(*data)
+	if n <= 0 {
+		return 0, ErrMalformed
+	}
+	*data = (*data)[n:]
+	return v, nil
+}
@@ -0,0 +1,85 @@
+package gens
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeys(t *testing.T) {
+	got := Keys("account:1:name", []string{"a", "b"}, true)
+	want := []string{
+		PrefixKey("account:"),
+		PrefixKey("account:1:"),
+		TagKey("a"),
+		TagKey("b"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if got := Keys("plain", nil, true); len(got) != 0 {
+		t.Errorf("want no keys, got %q", got)
+	}
+	if got := Keys("account:1:name", []string{"a"}, false); !reflect.DeepEqual(got, []string{TagKey("a")}) {
+		t.Errorf("want tag key only, got %q", got)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	keys := []string{"a", "bb"}
+	data := Encode([]byte("value"), keys, []int64{3, -1})
+
+	value, gotKeys, gotGens, err := Decode(data)
+	if err != nil {
+		t.Fatalf("cannot decode: %s", err)
+	}
+	if string(value) != "value" || !reflect.DeepEqual(gotKeys, keys) || !reflect.DeepEqual(gotGens, []int64{3, -1}) {
+		t.Errorf("unexpected result: %q %q %v", value, gotKeys, gotGens)
+	}
+
+	if !Valid(gotKeys, gotGens, map[string]int64{"a": 3, "bb": -1}) {
+		t.Error("want valid")
+	}
+	if Valid(gotKeys, gotGens, map[string]int64{"a": 4, "bb": -1}) {
+		t.Error("want invalid")
+	}
+
+	// counters are not wrapped
+	value, gotKeys, _, err = Decode([]byte("42"))
+	if err != nil || string(value) != "42" || len(gotKeys) != 0 {
+		t.Errorf("want plain value, got %q, %q, %v", value, gotKeys, err)
+	}
+
+	if got := Encode([]byte("42"), nil, nil); string(got) != "42" {
+		t.Errorf("want plain value, got %q", got)
+	}
+	value, _, _, err = Decode(Encode([]byte{magic, 1}, nil, nil))
+	if err != nil || string(value) != string([]byte{magic, 1}) {
+		t.Errorf("want value starting with magic wrapped, got %q, %v", value, err)
+	}
+
+	if _, _, _, err := Decode(data[:4]); err != ErrMalformed {
+		t.Errorf("want ErrMalformed, got %v", err)
+	}
+}
+
+func TestIsCounter(t *testing.T) {
+	for value, want := range map[string]bool{
+		"0":     true,
+		"-12":   true,
+		"":      false,
+		"-":     false,
+		"1.5":   false,
+		"\"a\"": false,
+	} {
+		if got := IsCounter([]byte(value)); got != want {
+			t.Errorf("%q: want %v", value, want)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	keys := Keys("account:1:name", []string{"a", "b"}, true)
+	if got := Tags(keys); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("want [a b], got %q", got)
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+// maxIndexLevel is the maximum number of levels of the key index, enough for
+// billions of items.
+const maxIndexLevel = 16
+
+// keyIndex is a skip list keeping items sorted by their keys, so that items
+// with keys starting with given prefix can be found without checking all of
+// them. Links are stored in the items. Keys must be unique.
+type keyIndex struct {
+	head  item
+	level int
+	// seed is the state of the level generator
+	seed uint32
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		head:  item{next: make([]*item, maxIndexLevel)},
+		level: 1,
+		seed:  2463534242,
+	}
+}
+
+// insert add item to the index.
+func (x *keyIndex) insert(it *item) {
+	var update [maxIndexLevel]*item
+	n := &x.head
+	for l := x.level - 1; l >= 0; l-- {
+		for n.next[l] != nil && n.next[l].key < it.key {
+			n = n.next[l]
+		}
+		update[l] = n
+	}
+	level := x.randomLevel()
+	for ; x.level < level; x.level++ {
+		update[x.level] = &x.head
+	}
+	it.next = make([]*item, level)
+	for l := range it.next {
+		it.next[l] = update[l].next[l]
+		update[l].next[l] = it
+	}
+}
+
+// remove delete item from the index.
+func (x *keyIndex) remove(it *item) {
+	n := &x.head
+	for l := x.level - 1; l >= 0; l-- {
+		for n.next[l] != nil && n.next[l].key < it.key {
+			n = n.next[l]
+		}
+		if n.next[l] == it {
+			n.next[l] = it.next[l]
+		}
+	}
+	for x.level > 1 && x.head.next[x.level-1] == nil {
+		x.level--
+	}
+}
+
+// seek return the first item with key not less than given one, or nil.
+// Following items are linked by next[0].
+func (x *keyIndex) seek(key string) *item {
+	n := &x.head
+	for l := x.level - 1; l >= 0; l-- {
+		for n.next[l] != nil && n.next[l].key < key {
+			n = n.next[l]
+		}
+	}
+	return n.next[0]
+}
+
+// randomLevel return level of the new item. Every level is four times less
+// likely than the previous one.
+func (x *keyIndex) randomLevel() int {
+	x.seed ^= x.seed << 13
+	x.seed ^= x.seed >> 17
+	x.seed ^= x.seed << 5
+	level := 1
+	for r := x.seed; level < maxIndexLevel && r&3 == 0; r >>= 2 {
+		level++
+	}
+	return level
+}
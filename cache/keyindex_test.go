@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	x := newKeyIndex()
+	items := make(map[string]*item)
+	for _, n := range rand.Perm(1000) {
+		it := &item{key: strconv.Itoa(n)}
+		items[it.key] = it
+		x.insert(it)
+	}
+	for key, it := range items {
+		if len(key) == 2 {
+			x.remove(it)
+			delete(items, key)
+		}
+	}
+
+	var want []string
+	for key := range items {
+		want = append(want, key)
+	}
+	sort.Strings(want)
+	var got []string
+	for it := x.seek(""); it != nil; it = it.next[0] {
+		got = append(got, it.key)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %d keys, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%d: want %q, got %q", i, want[i], got[i])
+		}
+	}
+
+	if it := x.seek("55"); it == nil || it.key != "550" {
+		t.Errorf("want 550, got %v", it)
+	}
+	if it := x.seek("999a"); it != nil {
+		t.Errorf("want nil, got %q", it.key)
+	}
+}
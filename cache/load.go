@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Loader return value for the cache entry that is missing.
+type Loader func(ctx context.Context) (interface{}, error)
+
+// LoadOpts defines how loaded values are cached.
+type LoadOpts struct {
+	// TTL is the time loaded value is considered fresh.
+	TTL time.Duration
+	// Stale is additional time after TTL, during which expired value is
+	// still returned, while new one is being loaded in the background.
+	Stale time.Duration
+	// NegativeTTL is the time ErrNotFound returned by the loader is
+	// cached for. Zero means not found results are not cached.
+	NegativeTTL time.Duration
+	// LoadTimeout is the time loader can take. Loader is not bound to the
+	// context of the caller, because its result is shared by all callers
+	// waiting for the same key and by the background refresh of the stale
+	// value, that usually completes after the caller is done. Defaults to
+	// 30 seconds.
+	LoadTimeout time.Duration
+}
+
+// GetOrLoad load value stored under given key into dest. If value is not
+// present in the cache, loader is called to compute it and the result is
+// stored for ttl duration.
+//
+// Concurrent calls for the same missing key are collapsed into single loader
+// call, that all callers wait for. Caller stops waiting when its context is
+// done, but the loader keeps running for the others. If the loader panics,
+// the panic is raised in all waiting callers.
+//
+// Values are serialized using the codec of the cache and are stored
+// together with the loading metadata as []byte, that the codec must support.
+func GetOrLoad(ctx context.Context, c Cache, key string, dest interface{}, ttl time.Duration, load Loader) error {
+	return GetOrLoadOpts(ctx, c, key, dest, load, &LoadOpts{TTL: ttl})
+}
+
+// GetOrLoadOpts works as GetOrLoad, but allows to serve stale values and to
+// cache not found results. See LoadOpts.
+func GetOrLoadOpts(ctx context.Context, c Cache, key string, dest interface{}, load Loader, o *LoadOpts) error {
+	codec := codecOf(c)
+	fk := flightKey{identity(c), key}
+	var raw []byte
+	switch err := c.Get(key, &raw); err {
+	case nil:
+		entry, err := decodeEntry(raw)
+		if err != nil {
+			return err
+		}
+		if entry.missing {
+			return ErrNotFound
+		}
+		if !entry.fresh.IsZero() && currentTime().After(entry.fresh) {
+			flights.start(fk, func() ([]byte, error) {
+				value, err := loadEntryValue(ctx, c, key, load, o)
+				if err != nil && err != ErrNotFound {
+					log.Printf("cannot refresh %q cache entry: %s", key, err)
+				}
+				return value, err
+			})
+		}
+		return codec.Unmarshal(entry.value, dest)
+	case ErrNotFound:
+		// value must be loaded
+	default:
+		return err
+	}
+
+	value, err := flights.do(ctx, fk, func() ([]byte, error) {
+		return loadEntryValue(ctx, c, key, load, o)
+	})
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(value, dest)
+}
+
+// detached is context carrying values of the parent context, but not its
+// deadline and cancellation.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// rebind return given cache bound to ctx instead of the context it is
+// currently bound to.
+func rebind(ctx context.Context, c Cache) Cache {
+	if b, ok := c.(bound); ok {
+		return Bind(ctx, b.c)
+	}
+	return bind(ctx, c)
+}
+
+// loadEntry is the cache entry written by GetOrLoad.
+type loadEntry struct {
+	value   []byte
+	missing bool
+	// fresh is the time until value does not require refreshing. Zero
+	// means value is always fresh.
+	fresh time.Time
+}
+
+// entry is encoded as flags byte, followed by fresh time as unix nanoseconds
+// and serialized value
+const (
+	entryHeaderSize = 9
+
+	entryMissing byte = 1
+)
+
+var errMalformedEntry = errors.New("malformed loaded cache entry")
+
+func (e *loadEntry) encode() []byte {
+	b := make([]byte, entryHeaderSize, entryHeaderSize+len(e.value))
+	if e.missing {
+		b[0] = entryMissing
+	}
+	if !e.fresh.IsZero() {
+		binary.BigEndian.PutUint64(b[1:], uint64(e.fresh.UnixNano()))
+	}
+	return append(b, e.value...)
+}
+
+func decodeEntry(b []byte) (*loadEntry, error) {
+	if len(b) < entryHeaderSize {
+		return nil, errMalformedEntry
+	}
+	e := &loadEntry{
+		value:   b[entryHeaderSize:],
+		missing: b[0]&entryMissing != 0,
+	}
+	if ns := int64(binary.BigEndian.Uint64(b[1:])); ns != 0 {
+		e.fresh = time.Unix(0, ns)
+	}
+	return e, nil
+}
+
+// loadEntryValue call loader and store the result in the cache. Serialized
+// value is returned. Loader is called with context detached from the one of
+// the caller.
+func loadEntryValue(ctx context.Context, c Cache, key string, load Loader, o *LoadOpts) ([]byte, error) {
+	timeout := o.LoadTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(detached{ctx}, timeout)
+	defer cancel()
+	c = rebind(ctx, c)
+
+	value, err := load(ctx)
+	if err == ErrNotFound {
+		if o.NegativeTTL > 0 {
+			entry := loadEntry{missing: true, fresh: currentTime().Add(o.NegativeTTL)}
+			if err := c.PutTTL(key, entry.encode(), o.NegativeTTL); err != nil {
+				log.Printf("cannot cache missing %q entry: %s", key, err)
+			}
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := codecOf(c).Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	entry := loadEntry{value: raw}
+	ttl := o.TTL
+	if ttl > 0 {
+		entry.fresh = currentTime().Add(ttl)
+		ttl += o.Stale
+	}
+	if err := c.PutTTL(key, entry.encode(), ttl); err != nil {
+		// loaded value is still valid, even if it cannot be cached
+		log.Printf("cannot cache %q entry: %s", key, err)
+	}
+	return raw, nil
+}
+
+var flights = flightGroup{calls: make(map[flightKey]*flightCall)}
+
+type flightKey struct {
+	// cache is the identity of the cache, see Unwrapper
+	cache interface{}
+	key   string
+}
+
+// flightGroup deduplicate concurrent function calls with the same key.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[flightKey]*flightCall
+}
+
+type flightCall struct {
+	// done is closed when the call returns
+	done chan struct{}
+	val  []byte
+	err  error
+	// panic is the value function panicked with, if it did
+	panic interface{}
+}
+
+// do call given function, unless call with the same key is in progress, and
+// wait for the result. Function is called in a separate goroutine, so that
+// it is not interrupted when the caller stops waiting because of context
+// being done. If function panics, the panic is raised again.
+func (g *flightGroup) do(ctx context.Context, k flightKey, fn func() ([]byte, error)) ([]byte, error) {
+	c := g.start(k, fn)
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if c.panic != nil {
+		panic(c.panic)
+	}
+	return c.val, c.err
+}
+
+// start call given function in the background, unless call with the same key
+// is in progress. Started or already running call is returned.
+func (g *flightGroup) start(k flightKey, fn func() ([]byte, error)) *flightCall {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.calls[k]; ok {
+		return c
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[k] = c
+	go g.run(k, c, fn)
+	return c
+}
+
+func (g *flightGroup) run(k flightKey, c *flightCall, fn func() ([]byte, error)) {
+	defer func() {
+		// panic is raised again in all waiting callers, but there might be
+		// none, for example during background refresh
+		if r := recover(); r != nil {
+			c.panic = r
+			log.Printf("cache loader panic: %v\n%s", r, debug.Stack())
+		}
+		g.mu.Lock()
+		delete(g.calls, k)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.val, c.err = fn()
+}
+
+// we want to mock current time in tests
+var currentTime = time.Now
@@ -0,0 +1,338 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	c := newLocalCache(10)
+	ctx := context.Background()
+
+	var calls int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var val int
+			if err := GetOrLoad(ctx, c, "answer", &val, time.Minute, load); err != nil {
+				t.Errorf("cannot load: %s", err)
+			}
+			if val != 42 {
+				t.Errorf("want 42, got %d", val)
+			}
+		}()
+	}
+	// give goroutines time to block on the loader
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("want single loader call, got %d", calls)
+	}
+
+	// cached value must be used
+	var val int
+	if err := GetOrLoad(ctx, c, "answer", &val, time.Minute, load); err != nil || val != 42 {
+		t.Errorf("want 42, got %d, %v", val, err)
+	}
+	if calls != 1 {
+		t.Errorf("want single loader call, got %d", calls)
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	c := newLocalCache(10)
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	var calls int
+	load := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return nil, errBoom
+	}
+	var val int
+	for i := 0; i < 2; i++ {
+		if err := GetOrLoad(ctx, c, "x", &val, time.Minute, load); err != errBoom {
+			t.Errorf("want errBoom, got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("errors must not be cached, got %d calls", calls)
+	}
+}
+
+func TestGetOrLoadNegative(t *testing.T) {
+	now := time.Now()
+	defer func() { currentTime = time.Now }()
+	currentTime = func() time.Time { return now }
+
+	c := newLocalCache(10)
+	c.now = currentTime
+	ctx := context.Background()
+
+	var calls int
+	load := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return nil, ErrNotFound
+	}
+	opts := &LoadOpts{TTL: time.Minute, NegativeTTL: time.Second}
+
+	var val int
+	for i := 0; i < 3; i++ {
+		if err := GetOrLoadOpts(ctx, c, "x", &val, load, opts); err != ErrNotFound {
+			t.Errorf("want ErrNotFound, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("want single loader call, got %d", calls)
+	}
+
+	now = now.Add(2 * time.Second)
+	if err := GetOrLoadOpts(ctx, c, "x", &val, load, opts); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("want loader call after negative entry expired, got %d", calls)
+	}
+}
+
+func TestGetOrLoadStale(t *testing.T) {
+	now := time.Now()
+	defer func() { currentTime = time.Now }()
+	currentTime = func() time.Time { return now }
+
+	c := newLocalCache(10)
+	c.now = currentTime
+	ctx := context.Background()
+
+	var value int32 = 1
+	refreshed := make(chan struct{}, 1)
+	load := func(ctx context.Context) (interface{}, error) {
+		defer func() { refreshed <- struct{}{} }()
+		return atomic.LoadInt32(&value), nil
+	}
+	opts := &LoadOpts{TTL: time.Minute, Stale: time.Hour}
+
+	var val int
+	if err := GetOrLoadOpts(ctx, c, "x", &val, load, opts); err != nil || val != 1 {
+		t.Fatalf("want 1, got %d, %v", val, err)
+	}
+	<-refreshed
+
+	atomic.StoreInt32(&value, 2)
+	now = now.Add(2 * time.Minute)
+
+	// stale value is returned, while new one is loaded in the background
+	if err := GetOrLoadOpts(ctx, c, "x", &val, load, opts); err != nil || val != 1 {
+		t.Fatalf("want stale 1, got %d, %v", val, err)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("value not refreshed")
+	}
+	// wait for the refresh to be unregistered
+	waitForFlights()
+	if err := GetOrLoadOpts(ctx, c, "x", &val, load, opts); err != nil || val != 2 {
+		t.Fatalf("want 2, got %d, %v", val, err)
+	}
+
+	// value older than stale period must be loaded synchronously
+	atomic.StoreInt32(&value, 3)
+	now = now.Add(2 * time.Hour)
+	if err := GetOrLoadOpts(ctx, c, "x", &val, load, opts); err != nil || val != 3 {
+		t.Fatalf("want 3, got %d, %v", val, err)
+	}
+}
+
+func TestGetOrLoadStaleDetached(t *testing.T) {
+	now := time.Now()
+	defer func() { currentTime = time.Now }()
+	currentTime = func() time.Time { return now }
+
+	c := newLocalCache(10)
+	c.now = currentTime
+	opts := &LoadOpts{TTL: time.Minute, Stale: time.Hour}
+	var val string
+	must(GetOrLoadOpts(context.Background(), c, "x", &val, func(context.Context) (interface{}, error) {
+		return "old", nil
+	}, opts))
+	now = now.Add(2 * time.Minute)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "user", "bob"))
+	canceled := make(chan struct{})
+	result := make(chan error, 1)
+	load := func(ctx context.Context) (interface{}, error) {
+		<-canceled
+		if err := ctx.Err(); err != nil {
+			result <- err
+			return nil, err
+		}
+		result <- nil
+		return ctx.Value("user"), nil
+	}
+	if err := GetOrLoadOpts(ctx, c, "x", &val, load, opts); err != nil || val != "old" {
+		t.Fatalf("want stale value, got %q, %v", val, err)
+	}
+	// request is done before the refresh completes
+	cancel()
+	close(canceled)
+	if err := <-result; err != nil {
+		t.Fatalf("refresh canceled: %s", err)
+	}
+	waitForFlights()
+	if err := GetOrLoadOpts(context.Background(), c, "x", &val, load, opts); err != nil || val != "bob" {
+		t.Fatalf("want refreshed value, got %q, %v", val, err)
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	c := newLocalCache(10)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	load := func(context.Context) (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != "boom" {
+					t.Errorf("want boom panic, got %v", r)
+				}
+			}()
+			var val int
+			GetOrLoad(ctx, c, "x", &val, time.Minute, load)
+		}()
+	}
+	// give goroutines time to block on the loader
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	var val int
+	if err := c.Get("x", &val); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	waitForFlights()
+}
+
+func TestGetOrLoadCallerDone(t *testing.T) {
+	c := newLocalCache(10)
+
+	release := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return 42, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		var val int
+		first <- GetOrLoad(ctx, c, "answer", &val, time.Minute, load)
+	}()
+	// give the first caller time to start the loader
+	time.Sleep(20 * time.Millisecond)
+	second := make(chan error, 1)
+	var val int
+	go func() {
+		second <- GetOrLoad(context.Background(), c, "answer", &val, time.Minute, load)
+	}()
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil || val != 42 {
+		t.Errorf("want 42, got %d, %v", val, err)
+	}
+}
+
+func TestGetOrLoadCodec(t *testing.T) {
+	c := newLocalCache(10)
+	c.codec = Raw
+	ctx := context.Background()
+
+	load := func(context.Context) (interface{}, error) {
+		return []byte("raw value"), nil
+	}
+	for i := 0; i < 2; i++ {
+		var val []byte
+		if err := GetOrLoad(ctx, c, "x", &val, time.Minute, load); err != nil || string(val) != "raw value" {
+			t.Fatalf("%d: want raw value, got %q, %v", i, val, err)
+		}
+	}
+}
+
+// waitForFlights block until all loader calls are unregistered.
+func waitForFlights() {
+	for {
+		flights.mu.Lock()
+		n := len(flights.calls)
+		flights.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetOrLoadContextCache(t *testing.T) {
+	base := WithContextCache(context.Background(), Contextual(newLocalCache(10)))
+
+	var calls int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every request has its own context and cache bound to it
+			ctx, cancel := context.WithCancel(base)
+			defer cancel()
+			c, _ := From(ctx)
+			var val int
+			if err := GetOrLoad(ctx, c, "answer", &val, time.Minute, load); err != nil || val != 42 {
+				t.Errorf("want 42, got %d, %v", val, err)
+			}
+		}()
+	}
+	// give goroutines time to block on the loader
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("want single loader call, got %d", calls)
+	}
+}
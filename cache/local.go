@@ -2,28 +2,130 @@ package cache
 
 import (
 	"container/list"
-	"encoding/json"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 )
 
 type localCache struct {
-	mu      sync.Mutex
-	maxsize int
-	idx     map[string]*item
-	order   *list.List
+	mu       sync.Mutex
+	maxsize  int
+	maxbytes int64
+	idx      map[string]*item
+	order    *list.List
+	now      func() time.Time
+	stats    Stats
+	codec    Codec
+	// groups index items by their tags
+	groups map[string]map[*item]struct{}
+	// keys keep items sorted by key, for prefix removal
+	keys *keyIndex
+	// version is incremented with every write
+	version uint64
 }
 
 type item struct {
-	key string
-	val []byte
-	el  *list.Element
+	key     string
+	val     []byte
+	el      *list.Element
+	expires time.Time
+	version uint64
+	tags    []string
+	// next links item in the key index
+	next []*item
 }
 
+// groups return names of all groups item belongs to.
+func (it *item) groups() []string {
+	names := make([]string, len(it.tags))
+	for i, tag := range it.tags {
+		names[i] = tagGroup(tag)
+	}
+	return names
+}
+
+func tagGroup(tag string) string { return "t:" + tag }
+
+// size return estimated amount of memory used by the item, including its
+// tags index entries.
+func (it *item) size() int64 {
+	size := len(it.key) + len(it.val) + itemOverhead
+	for _, tag := range it.tags {
+		size += len(tag) + tagOverhead
+	}
+	return int64(size)
+}
+
+// itemOverhead is approximate memory cost of item structure, its list
+// element and index entries.
+const itemOverhead = 192
+
+// tagOverhead is approximate memory cost of item entry in the tag index.
+const tagOverhead = 64
+
+func (it *item) expired(now time.Time) bool {
+	return !it.expires.IsZero() && !now.Before(it.expires)
+}
+
+// JanitorInterval defines how often local cache is removing expired entries.
+var JanitorInterval = time.Minute
+
+// WithLocalCache return context carrying in memory cache that can hold up to
+// maxsize entries. When full, least recently used entries are evicted.
+//
+// Expired entries are removed periodically by background process, that runs
+// until given context is done.
 func WithLocalCache(ctx context.Context, maxsize int) context.Context {
-	c := newLocalCache(maxsize)
-	return context.WithValue(ctx, contextKey, c)
+	return withLocalCache(ctx, newLocalCache(maxsize))
+}
+
+// WithLocalCacheBytes return context carrying in memory cache that is limited
+// by estimated memory usage of stored entries instead of their number. When
+// full, least recently used entries are evicted. Values bigger than the whole
+// budget are rejected with ErrTooLarge.
+//
+// Expired entries are removed periodically by background process, that runs
+// until given context is done.
+func WithLocalCacheBytes(ctx context.Context, maxbytes int64) context.Context {
+	c := newLocalCache(0)
+	c.maxbytes = maxbytes
+	return withLocalCache(ctx, c)
+}
+
+// LocalOpts defines in memory cache settings.
+type LocalOpts struct {
+	// MaxSize is the maximum number of entries. Ignored if MaxBytes is
+	// set. Defaults to 1000 if neither MaxSize nor MaxBytes is set.
+	MaxSize int
+	// MaxBytes is the limit of estimated memory usage of stored entries.
+	MaxBytes int64
+	// Codec is used to serialize values. Defaults to JSON.
+	Codec Codec
+}
+
+// WithLocalCacheOpts return context carrying in memory cache configured with
+// given options. See WithLocalCache and WithLocalCacheBytes.
+func WithLocalCacheOpts(ctx context.Context, o *LocalOpts) context.Context {
+	var opts LocalOpts
+	if o != nil {
+		opts = *o
+	}
+	if opts.MaxSize <= 0 && opts.MaxBytes <= 0 {
+		opts.MaxSize = 1000
+	}
+	c := newLocalCache(opts.MaxSize)
+	c.maxbytes = opts.MaxBytes
+	if opts.Codec != nil {
+		c.codec = opts.Codec
+	}
+	return withLocalCache(ctx, c)
+}
+
+func withLocalCache(ctx context.Context, c *localCache) context.Context {
+	c.startJanitor(ctx)
+	return WithCache(ctx, c)
 }
 
 func newLocalCache(maxsize int) *localCache {
@@ -31,47 +133,302 @@ func newLocalCache(maxsize int) *localCache {
 		idx:     make(map[string]*item, maxsize*2),
 		maxsize: maxsize,
 		order:   list.New(),
+		now:     time.Now,
+		codec:   JSON,
+		groups:  make(map[string]map[*item]struct{}),
+		keys:    newKeyIndex(),
 	}
 }
 
-func (c *localCache) Get(key string, dest interface{}) error {
+// startJanitor run janitor in the background, until context is done.
+func (c *localCache) startJanitor(ctx context.Context) {
+	t := time.NewTicker(JanitorInterval)
+	go func() {
+		c.janitor(ctx, t.C)
+		t.Stop()
+	}()
+}
+
+// janitor remove expired entries every time tick is received, until context
+// is done.
+func (c *localCache) janitor(ctx context.Context, tick <-chan time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			c.removeExpired()
+		}
+	}
+}
+
+func (c *localCache) removeExpired() {
+	c.mu.Lock()
+	now := c.now()
+	for _, it := range c.idx {
+		if it.expired(now) {
+			c.remove(it)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// clear remove all items.
+func (c *localCache) clear() {
+	c.mu.Lock()
+	c.idx = make(map[string]*item, c.maxsize*2)
+	c.groups = make(map[string]map[*item]struct{})
+	c.keys = newKeyIndex()
+	c.order.Init()
+	c.stats.Bytes = 0
+	c.mu.Unlock()
+}
+
+// remove delete item from the cache. Caller must hold the lock.
+func (c *localCache) remove(it *item) {
+	c.order.Remove(it.el)
+	delete(c.idx, it.key)
+	c.keys.remove(it)
+	c.stats.Bytes -= it.size()
+	for _, name := range it.groups() {
+		group := c.groups[name]
+		delete(group, it)
+		if len(group) == 0 {
+			delete(c.groups, name)
+		}
+	}
+}
+
+// full return true if cache is over its size limit. Caller must hold the
+// lock.
+func (c *localCache) full() bool {
+	if c.maxbytes > 0 {
+		return c.stats.Bytes > c.maxbytes
+	}
+	return len(c.idx) > c.maxsize
+}
+
+// Stats return current cache usage.
+func (c *localCache) Stats() Stats {
 	c.mu.Lock()
+	s := c.stats
+	s.Entries = len(c.idx)
+	c.mu.Unlock()
+	return s
+}
+
+// lookup return valid item stored under given key. Expired item is removed.
+// Caller must hold the lock.
+func (c *localCache) lookup(key string) (*item, bool) {
 	it, ok := c.idx[key]
+	if ok && it.expired(c.now()) {
+		c.remove(it)
+		ok = false
+	}
+	return it, ok
+}
+
+// store insert new item, replacing existing one if present and evicting
+// least recently used items if necessary. Caller must hold the lock.
+func (c *localCache) store(key string, raw []byte, ttl time.Duration, tags []string) {
+	if old, ok := c.idx[key]; ok {
+		c.remove(old)
+	}
+	c.version++
+	it := &item{key: key, val: raw, version: c.version, tags: tags}
+	if ttl > 0 {
+		it.expires = c.now().Add(ttl)
+	}
+	c.idx[it.key] = it
+	c.keys.insert(it)
+	for _, name := range it.groups() {
+		group, ok := c.groups[name]
+		if !ok {
+			group = make(map[*item]struct{})
+			c.groups[name] = group
+		}
+		group[it] = struct{}{}
+	}
+	it.el = c.order.PushFront(it)
+	c.stats.Bytes += it.size()
+	for c.full() {
+		last := c.order.Back().Value.(*item)
+		c.remove(last)
+		c.stats.Evictions++
+	}
+}
+
+// marshal serialize given value and validate size of the item.
+func (c *localCache) marshal(key string, src interface{}, tags []string) ([]byte, error) {
+	raw, err := c.codec.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	it := item{key: key, val: raw, tags: tags}
+	if c.maxbytes > 0 && it.size() > c.maxbytes {
+		return nil, ErrTooLarge
+	}
+	return raw, nil
+}
+
+// Codec return codec used to serialize values.
+func (c *localCache) Codec() Codec {
+	return c.codec
+}
+
+func (c *localCache) Get(key string, dest interface{}) error {
+	_, err := c.GetVersion(key, dest)
+	return err
+}
+
+func (c *localCache) GetVersion(key string, dest interface{}) (uint64, error) {
+	c.mu.Lock()
+	it, ok := c.lookup(key)
 	if ok {
 		c.order.MoveToFront(it.el)
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
 	}
 	c.mu.Unlock()
 
 	if !ok {
-		return ErrNotFound
+		return 0, ErrNotFound
 	}
-	return json.Unmarshal(it.val, dest)
+	return it.version, c.codec.Unmarshal(it.val, dest)
 }
 
 func (c *localCache) Put(key string, src interface{}) error {
-	raw, err := json.Marshal(src)
+	return c.PutTTL(key, src, 0)
+}
+
+func (c *localCache) PutTTL(key string, src interface{}, ttl time.Duration) error {
+	return c.PutTagged(key, src, ttl)
+}
+
+func (c *localCache) PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) error {
+	raw, err := c.marshal(key, src, tags)
 	if err != nil {
-		return nil
+		return err
 	}
-	it := &item{key: key, val: raw}
 	c.mu.Lock()
-	c.idx[it.key] = it
-	it.el = c.order.PushFront(it)
-	for len(c.idx) > c.maxsize {
-		last := c.order.Back().Value.(*item)
-		c.order.Remove(last.el)
-		delete(c.idx, last.key)
-	}
+	c.store(key, raw, ttl, tags)
 	c.mu.Unlock()
 	return nil
 }
 
+func (c *localCache) Add(key string, src interface{}, ttl time.Duration) error {
+	raw, err := c.marshal(key, src, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.lookup(key); ok {
+		return ErrConflict
+	}
+	c.store(key, raw, ttl, nil)
+	return nil
+}
+
+func (c *localCache) Replace(key string, src interface{}, ttl time.Duration) error {
+	raw, err := c.marshal(key, src, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	it, ok := c.lookup(key)
+	if !ok {
+		return ErrNotFound
+	}
+	// overwritten value keeps its tags
+	c.store(key, raw, ttl, it.tags)
+	return nil
+}
+
+func (c *localCache) CompareAndSwap(key string, src interface{}, version uint64, ttl time.Duration) error {
+	raw, err := c.marshal(key, src, nil)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	it, ok := c.lookup(key)
+	if !ok {
+		return ErrNotFound
+	}
+	if it.version != version {
+		return ErrConflict
+	}
+	// overwritten value keeps its tags
+	c.store(key, raw, ttl, it.tags)
+	return nil
+}
+
+// Incr modify counter, that is serialized using cache codec like any other
+// value.
+func (c *localCache) Incr(key string, delta int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	var ttl time.Duration
+	var tags []string
+	if it, ok := c.lookup(key); ok {
+		if err := c.codec.Unmarshal(it.val, &n); err != nil {
+			return 0, ErrNotInteger
+		}
+		if !it.expires.IsZero() {
+			ttl = it.expires.Sub(c.now())
+		}
+		tags = it.tags
+	}
+	n += delta
+	raw, err := c.codec.Marshal(n)
+	if err != nil {
+		return 0, err
+	}
+	c.store(key, raw, ttl, tags)
+	return n, nil
+}
+
+func (c *localCache) Decr(key string, delta int64) (int64, error) {
+	return c.Incr(key, -delta)
+}
+
 func (c *localCache) Del(key string) error {
 	c.mu.Lock()
 	if it, ok := c.idx[key]; ok {
-		delete(c.idx, key)
-		c.order.Remove(it.el)
+		c.remove(it)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *localCache) InvalidateTag(tag string) error {
+	c.removeGroup(tagGroup(tag))
+	return nil
+}
+
+// DelPrefix remove all values with key starting with given prefix. Keys are
+// kept sorted, so only removed values are visited.
+func (c *localCache) DelPrefix(prefix string) error {
+	c.mu.Lock()
+	it := c.keys.seek(prefix)
+	for it != nil && strings.HasPrefix(it.key, prefix) {
+		next := it.next[0]
+		c.remove(it)
+		it = next
 	}
 	c.mu.Unlock()
 	return nil
 }
+
+func (c *localCache) removeGroup(name string) {
+	c.mu.Lock()
+	for it := range c.groups[name] {
+		c.remove(it)
+	}
+	c.mu.Unlock()
+}
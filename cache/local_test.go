@@ -1,6 +1,15 @@
 package cache
 
-import "testing"
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
 
 func TestLocalCache(t *testing.T) {
 	c := newLocalCache(2)
@@ -46,3 +55,330 @@ func must(err error) {
 		panic(err)
 	}
 }
+
+func TestLocalCacheTTL(t *testing.T) {
+	now := time.Now()
+	c := newLocalCache(10)
+	c.now = func() time.Time { return now }
+
+	must(c.PutTTL("a", 1, time.Minute))
+	must(c.PutTTL("b", 2, time.Hour))
+	must(c.Put("c", 3))
+
+	var val int
+	must(c.Get("a", &val))
+
+	now = now.Add(time.Minute)
+	if err := c.Get("a", &val); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if _, ok := c.idx["a"]; ok {
+		t.Error("expired entry must be removed on access")
+	}
+	must(c.Get("b", &val))
+	must(c.Get("c", &val))
+
+	now = now.Add(24 * time.Hour)
+	if err := c.Get("b", &val); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	must(c.Get("c", &val))
+}
+
+func TestLocalCacheJanitor(t *testing.T) {
+	now := time.Now()
+	c := newLocalCache(10)
+	c.now = func() time.Time { return now }
+
+	must(c.PutTTL("a", 1, time.Minute))
+	must(c.PutTTL("b", 2, time.Hour))
+	must(c.Put("c", 3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tick := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		c.janitor(ctx, tick)
+		close(done)
+	}()
+
+	now = now.Add(2 * time.Minute)
+	tick <- now
+	// second tick ensures first cleanup is complete
+	tick <- now
+
+	c.mu.Lock()
+	if _, ok := c.idx["a"]; ok {
+		t.Error("expired entry not removed")
+	}
+	if n := c.order.Len(); n != 2 {
+		t.Errorf("want 2 entries, got %d", n)
+	}
+	c.mu.Unlock()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("janitor not stopped")
+	}
+}
+
+func TestLocalCacheBytes(t *testing.T) {
+	c := newLocalCache(0)
+	c.maxbytes = 3 * (itemOverhead + 1 + 100)
+
+	value := strings.Repeat("x", 98) // JSON quotes make it 100 bytes long
+	must(c.Put("a", value))
+	must(c.Put("b", value))
+	must(c.Put("c", value))
+
+	var val string
+	must(c.Get("a", &val))
+
+	// 'b' is the least recently used
+	must(c.Put("d", value))
+	if err := c.Get("b", &val); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+
+	// bigger value must evict more entries
+	must(c.Put("e", strings.Repeat("x", 250)))
+	stats := c.Stats()
+	if stats.Entries != 2 {
+		t.Errorf("want 2 entries, got %d", stats.Entries)
+	}
+	if stats.Bytes > c.maxbytes {
+		t.Errorf("using %d bytes, limit is %d", stats.Bytes, c.maxbytes)
+	}
+	if stats.Evictions != 3 {
+		t.Errorf("want 3 evictions, got %d", stats.Evictions)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("want 1 hit and 1 miss, got %+v", stats)
+	}
+
+	if err := c.Put("huge", strings.Repeat("x", int(c.maxbytes))); err != ErrTooLarge {
+		t.Errorf("want ErrTooLarge, got %v", err)
+	}
+	if s := c.Stats(); s.Entries != 2 || s.Bytes != stats.Bytes {
+		t.Errorf("rejected value changed the cache: %+v", s)
+	}
+
+	// tags index is counted in the memory budget
+	tags := make([]string, int(c.maxbytes)/tagOverhead)
+	for i := range tags {
+		tags[i] = strconv.Itoa(i)
+	}
+	if err := c.PutTagged("tagged", 1, 0, tags...); err != ErrTooLarge {
+		t.Errorf("want ErrTooLarge, got %v", err)
+	}
+}
+
+func TestLocalCacheOverwrite(t *testing.T) {
+	c := newLocalCache(2)
+
+	must(c.Put("a", 1))
+	must(c.Put("a", 2))
+	must(c.Put("a", 3))
+	if n := c.order.Len(); n != 1 {
+		t.Errorf("want 1 list element, got %d", n)
+	}
+
+	must(c.Put("b", 1))
+	must(c.Put("a", 4))
+	// 'b' is the least recently used, so putting 'c' must evict it
+	must(c.Put("c", 1))
+
+	var val int
+	must(c.Get("a", &val))
+	if val != 4 {
+		t.Errorf("want 4, got %d", val)
+	}
+	if err := c.Get("b", &val); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if len(c.idx) != c.order.Len() {
+		t.Errorf("index has %d entries, list %d", len(c.idx), c.order.Len())
+	}
+}
+
+func TestLocalCacheMarshalError(t *testing.T) {
+	c := newLocalCache(2)
+	if err := c.Put("a", make(chan int)); err == nil {
+		t.Error("want error")
+	}
+}
+
+func TestLocalCacheAtomicOperations(t *testing.T) {
+	c := newLocalCache(10)
+
+	must(c.Add("a", 1, 0))
+	if err := c.Add("a", 2, 0); err != ErrConflict {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+
+	if err := c.Replace("b", 1, 0); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	must(c.Replace("a", 3, 0))
+
+	var val int
+	version, err := c.GetVersion("a", &val)
+	if err != nil || val != 3 {
+		t.Fatalf("want 3, got %d, %v", val, err)
+	}
+	must(c.CompareAndSwap("a", 4, version, 0))
+	if err := c.CompareAndSwap("a", 5, version, 0); err != ErrConflict {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+	if err := c.CompareAndSwap("x", 5, version, 0); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	must(c.Get("a", &val))
+	if val != 4 {
+		t.Errorf("want 4, got %d", val)
+	}
+
+	if n, err := c.Incr("counter", 5); err != nil || n != 5 {
+		t.Errorf("want 5, got %d, %v", n, err)
+	}
+	if n, err := c.Decr("counter", 7); err != nil || n != -2 {
+		t.Errorf("want -2, got %d, %v", n, err)
+	}
+	must(c.Get("counter", &val))
+	if val != -2 {
+		t.Errorf("want -2, got %d", val)
+	}
+	must(c.Put("text", "abc"))
+	if _, err := c.Incr("text", 1); err != ErrNotInteger {
+		t.Errorf("want ErrNotInteger, got %v", err)
+	}
+}
+
+func TestLocalCacheIncrKeepsTTL(t *testing.T) {
+	now := time.Now()
+	c := newLocalCache(10)
+	c.now = func() time.Time { return now }
+
+	must(c.Add("rate", 0, time.Minute))
+	for i := 0; i < 3; i++ {
+		if _, err := c.Incr("rate", 1); err != nil {
+			t.Fatalf("cannot increment: %s", err)
+		}
+	}
+	now = now.Add(time.Minute)
+	var val int
+	if err := c.Get("rate", &val); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestLocalCacheConcurrentIncr(t *testing.T) {
+	c := newLocalCache(10)
+
+	var wg sync.WaitGroup
+	var added int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := c.Incr("n", 1); err != nil {
+					t.Errorf("cannot increment: %s", err)
+				}
+			}
+			if c.Add("once", true, 0) == nil {
+				atomic.AddInt32(&added, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var n int
+	must(c.Get("n", &n))
+	if n != 5000 {
+		t.Errorf("want 5000, got %d", n)
+	}
+	if added != 1 {
+		t.Errorf("want single successful add, got %d", added)
+	}
+}
+
+func TestLocalCacheTagsAndPrefix(t *testing.T) {
+	c := newLocalCache(100)
+
+	must(c.PutTagged("account:1:name", "bob", 0, "account:1"))
+	must(c.PutTagged("account:1:email", "bob@example.com", 0, "account:1", "emails"))
+	must(c.PutTagged("account:2:email", "ann@example.com", 0, "emails"))
+	must(c.Put("account:2:name", "ann"))
+	must(c.Put("account:20:name", "joe"))
+	if _, err := c.Incr("account:1:logins", 1); err != nil {
+		t.Fatalf("cannot increment: %s", err)
+	}
+
+	must(c.InvalidateTag("emails"))
+	var s string
+	for _, key := range []string{"account:1:email", "account:2:email"} {
+		if err := c.Get(key, &s); err != ErrNotFound {
+			t.Errorf("%s: want ErrNotFound, got %v", key, err)
+		}
+	}
+	must(c.Get("account:1:name", &s))
+
+	must(c.DelPrefix("account:2:"))
+	if err := c.Get("account:2:name", &s); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	must(c.Get("account:20:name", &s))
+
+	// prefix does not have to end with separator
+	must(c.DelPrefix("account:2"))
+	if err := c.Get("account:20:name", &s); err != ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+
+	must(c.DelPrefix("account:"))
+	if s := c.Stats(); s.Entries != 0 || s.Bytes != 0 {
+		t.Errorf("want empty cache, got %+v", s)
+	}
+	if len(c.groups) != 0 {
+		t.Errorf("want no groups, got %d", len(c.groups))
+	}
+}
+
+func TestLocalCacheOverwriteKeepsTags(t *testing.T) {
+	c := newLocalCache(100)
+
+	must(c.PutTagged("a", 1, 0, "t"))
+	var val int
+	version, err := c.GetVersion("a", &val)
+	if err != nil {
+		t.Fatalf("cannot get: %s", err)
+	}
+	must(c.CompareAndSwap("a", 2, version, 0))
+	must(c.PutTagged("b", 1, 0, "t"))
+	must(c.Replace("b", 2, 0))
+
+	must(c.InvalidateTag("t"))
+	for _, key := range []string{"a", "b"} {
+		if err := c.Get(key, &val); err != ErrNotFound {
+			t.Errorf("%s: want ErrNotFound, got %v", key, err)
+		}
+	}
+}
+
+func TestLocalCacheOptsDefaults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := Get(WithLocalCacheOpts(ctx, nil))
+	for i := 0; i < 1001; i++ {
+		must(c.Put(strconv.Itoa(i), i))
+	}
+	var val int
+	if err := c.Get("0", &val); err != ErrNotFound {
+		t.Errorf("want first entry evicted, got %v", err)
+	}
+	must(c.Get("1000", &val))
+}
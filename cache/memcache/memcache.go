@@ -0,0 +1,695 @@
+// Package memcache implements cache.Cache backed by memcached servers.
+//
+// Client speaks memcached text protocol. Keys are distributed among all
+// servers using consistent hashing, so that adding or removing a server
+// moves only a small part of the keys. Every server has its own connection
+// pool.
+//
+// Tags and prefix invalidation are emulated using generation counters stored
+// on the servers. Invalidated values are not removed, but ignored until they
+// expire or are evicted. Because counters can be evicted as well, memcached
+// should have enough memory to not evict frequently used entries. Prefix
+// invalidation is costly and must be enabled, see Opts.Prefixes.
+//
+// Package provides minimal, in memory Server implementation, that can be used
+// for testing without running the real memcached instance.
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+	"github.com/husio/x/cache/internal/gens"
+)
+
+// Opts defines connection settings.
+type Opts struct {
+	// MaxIdle is the maximum number of idle connections kept in the pool of
+	// every server. Defaults to 4.
+	MaxIdle int
+	// DialTimeout defaults to 5 seconds.
+	DialTimeout time.Duration
+	// Timeout is the read and write deadline of every operation. Defaults
+	// to 3 seconds.
+	Timeout time.Duration
+	// Replicas is the number of points every server has on the hash ring.
+	// Defaults to 100.
+	Replicas int
+	// Codec is used to serialize values. Defaults to cache.JSON. Counters
+	// modified by Incr and Decr are always stored as decimal text, that can
+	// be read using cache.JSON or cache.Raw codec only. Integer values
+	// stored without tags can be modified by Incr and Decr.
+	Codec cache.Codec
+	// Prefixes enables DelPrefix, that otherwise return
+	// cache.ErrNotSupported. Every value with key containing ':' separator
+	// is then stored together with generations of all its prefixes, that
+	// must be read from the server when the value is written and read,
+	// costing an additional round trip.
+	Prefixes bool
+}
+
+var (
+	// ErrClosed is returned when using closed cache.
+	ErrClosed = errors.New("memcache: cache closed")
+	// ErrMalformedKey is returned for keys that are longer than 250 bytes
+	// or contain whitespace or control characters.
+	ErrMalformedKey = errors.New("memcache: malformed key")
+	// ErrNoServers is returned when cache was created without any server.
+	ErrNoServers = errors.New("memcache: no servers")
+
+	errProtocol = errors.New("memcache: protocol error")
+)
+
+// Error is the error reply returned by the server.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Cache is cache.Cache implementation using memcached servers as the storage.
+type Cache struct {
+	opts    Opts
+	servers []*server
+	ring    ring
+	// ctx, if set, limits the time of every operation
+	ctx context.Context
+	// parent is the cache this one was bound to the context from
+	parent *Cache
+}
+
+var (
+	_ cache.Cache     = (*Cache)(nil)
+	_ cache.Unwrapper = (*Cache)(nil)
+)
+
+// New return cache using memcached servers at given addresses. Connections
+// are created lazily.
+func New(addrs []string, o *Opts) *Cache {
+	if o == nil {
+		o = &Opts{}
+	}
+	opts := *o
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = 4
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	if opts.Replicas <= 0 {
+		opts.Replicas = 100
+	}
+	if opts.Codec == nil {
+		opts.Codec = cache.JSON
+	}
+
+	c := &Cache{
+		opts: opts,
+		ring: newRing(addrs, opts.Replicas),
+	}
+	for _, addr := range addrs {
+		c.servers = append(c.servers, &server{addr: addr})
+	}
+	return c
+}
+
+// WithContext return cache sharing connections with c, that is executing
+// operations with deadline of given context, if it is earlier than the
+// timeout.
+func (c *Cache) WithContext(ctx context.Context) cache.Cache {
+	cc := *c
+	cc.ctx = ctx
+	if cc.parent == nil {
+		cc.parent = c
+	}
+	return &cc
+}
+
+// Unwrap return the cache this one was bound to the context from, or nil.
+func (c *Cache) Unwrap() cache.Cache {
+	if c.parent == nil {
+		return nil
+	}
+	return c.parent
+}
+
+// deadline return time until which current operation must finish.
+func (c *Cache) deadline() time.Time {
+	deadline := time.Now().Add(c.opts.Timeout)
+	if c.ctx != nil {
+		if d, ok := c.ctx.Deadline(); ok && d.Before(deadline) {
+			return d
+		}
+	}
+	return deadline
+}
+
+// Close close all idle connections. Cache cannot be used after closing.
+func (c *Cache) Close() error {
+	var err error
+	for _, s := range c.servers {
+		if e := s.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+type server struct {
+	addr string
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+// get return idle connection from the pool or create new one.
+func (s *server) get(o *Opts, deadline time.Time) (*conn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(s.idle); n > 0 {
+		cn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return cn, nil
+	}
+	s.mu.Unlock()
+
+	dialer := net.Dialer{Timeout: o.DialTimeout, Deadline: deadline}
+	nc, err := dialer.Dial("tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{
+		nc: nc,
+		r:  bufio.NewReader(nc),
+		w:  bufio.NewWriter(nc),
+	}, nil
+}
+
+// put return connection to the pool. Connections that failed must not be
+// reused, because their state is unknown.
+func (s *server) put(cn *conn, failed bool, o *Opts) {
+	s.mu.Lock()
+	if !failed && !s.closed && len(s.idle) < o.MaxIdle {
+		s.idle = append(s.idle, cn)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	cn.nc.Close()
+}
+
+func (s *server) close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	var err error
+	for _, cn := range idle {
+		if e := cn.nc.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// withConn call given function with connection to the server responsible for
+// given key.
+func (c *Cache) withConn(key string, fn func(*conn) error) error {
+	if !validKey(key) {
+		return ErrMalformedKey
+	}
+	if len(c.servers) == 0 {
+		return ErrNoServers
+	}
+	return c.withServer(c.servers[c.ring.pick(key)], fn)
+}
+
+// withServer call given function with connection to given server.
+func (c *Cache) withServer(s *server, fn func(*conn) error) error {
+	if c.ctx != nil {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	deadline := c.deadline()
+	cn, err := s.get(&c.opts, deadline)
+	if err != nil {
+		return err
+	}
+	if err := cn.nc.SetDeadline(deadline); err != nil {
+		s.put(cn, true, &c.opts)
+		return err
+	}
+	err = fn(cn)
+	s.put(cn, !resumable(err), &c.opts)
+	return err
+}
+
+// resumable return true if after given error connection is still in a known
+// state and can be reused.
+func resumable(err error) bool {
+	switch err {
+	case nil, cache.ErrNotFound, cache.ErrConflict, cache.ErrNotInteger:
+		return true
+	}
+	_, ok := err.(Error)
+	return ok
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > 250 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (cn *conn) readLine() ([]byte, error) {
+	line, err := cn.r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, errProtocol
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// replyError return error for unexpected reply line.
+func replyError(line []byte) error {
+	switch {
+	case bytes.Equal(line, []byte("ERROR")):
+		return Error(line)
+	case bytes.HasPrefix(line, []byte("CLIENT_ERROR ")), bytes.HasPrefix(line, []byte("SERVER_ERROR ")):
+		return Error(line)
+	}
+	return errProtocol
+}
+
+// Codec return codec used to serialize values.
+func (c *Cache) Codec() cache.Codec {
+	return c.opts.Codec
+}
+
+func (c *Cache) Get(key string, dest interface{}) error {
+	_, err := c.GetVersion(key, dest)
+	return err
+}
+
+// GetVersion works like Get, but additionally return version of the value.
+// Version is the CAS identifier assigned by the server.
+func (c *Cache) GetVersion(key string, dest interface{}) (uint64, error) {
+	raw, version, err := c.getRaw(key)
+	if err != nil {
+		return 0, err
+	}
+	value, _, err := c.open(raw)
+	if err != nil {
+		return 0, err
+	}
+	return version, c.opts.Codec.Unmarshal(value, dest)
+}
+
+// getRaw return stored envelope and its CAS identifier.
+func (c *Cache) getRaw(key string) ([]byte, uint64, error) {
+	var raw []byte
+	var version uint64
+	err := c.withConn(key, func(cn *conn) error {
+		fmt.Fprintf(cn.w, "gets %s\r\n", key)
+		if err := cn.w.Flush(); err != nil {
+			return err
+		}
+		found := false
+		err := cn.readValues(func(_ string, value []byte, cas uint64) {
+			raw, version, found = value, cas, true
+		})
+		if err == nil && !found {
+			return cache.ErrNotFound
+		}
+		return err
+	})
+	return raw, version, err
+}
+
+// open return value stored in the envelope and tags it was stored with.
+// cache.ErrNotFound is returned if the value was invalidated.
+func (c *Cache) open(raw []byte) ([]byte, []string, error) {
+	value, keys, stored, err := gens.Decode(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keys) > 0 {
+		current, err := c.generations(keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !gens.Valid(keys, stored, current) {
+			return nil, nil, cache.ErrNotFound
+		}
+	}
+	return value, gens.Tags(keys), nil
+}
+
+// readValues read response of the gets command, calling given function for
+// every returned value.
+func (cn *conn) readValues(fn func(key string, value []byte, cas uint64)) error {
+	for {
+		line, err := cn.readLine()
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(line, []byte("END")) {
+			return nil
+		}
+		if !bytes.HasPrefix(line, []byte("VALUE ")) {
+			return replyError(line)
+		}
+		// VALUE <key> <flags> <bytes> <cas unique>
+		fields := strings.Fields(string(line))
+		if len(fields) != 5 {
+			return errProtocol
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil || size < 0 {
+			return errProtocol
+		}
+		cas, err := strconv.ParseUint(fields[4], 10, 64)
+		if err != nil {
+			return errProtocol
+		}
+		raw := make([]byte, size+2)
+		if _, err := io.ReadFull(cn.r, raw); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(raw, []byte("\r\n")) {
+			return errProtocol
+		}
+		fn(fields[1], raw[:size], cas)
+	}
+}
+
+// generations return current values of given generation counters. Counters
+// are distributed among servers like any other key.
+func (c *Cache) generations(keys []string) (map[string]int64, error) {
+	if len(keys) > 0 && len(c.servers) == 0 {
+		return nil, ErrNoServers
+	}
+	byServer := make(map[*server][]string)
+	for _, key := range keys {
+		if !validKey(key) {
+			return nil, ErrMalformedKey
+		}
+		s := c.servers[c.ring.pick(key)]
+		byServer[s] = append(byServer[s], key)
+	}
+
+	current := make(map[string]int64, len(keys))
+	for s, keys := range byServer {
+		err := c.withServer(s, func(cn *conn) error {
+			fmt.Fprintf(cn.w, "gets %s\r\n", strings.Join(keys, " "))
+			if err := cn.w.Flush(); err != nil {
+				return err
+			}
+			var perr error
+			err := cn.readValues(func(key string, value []byte, _ uint64) {
+				n, err := strconv.ParseInt(string(value), 10, 64)
+				if err != nil {
+					perr = errProtocol
+				}
+				current[key] = n
+			})
+			if err != nil {
+				return err
+			}
+			return perr
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func (c *Cache) Put(key string, src interface{}) error {
+	return c.PutTTL(key, src, 0)
+}
+
+func (c *Cache) PutTTL(key string, src interface{}, ttl time.Duration) error {
+	return c.store("set", key, src, ttl, 0)
+}
+
+func (c *Cache) PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) error {
+	return c.store("set", key, src, ttl, 0, tags...)
+}
+
+func (c *Cache) Add(key string, src interface{}, ttl time.Duration) error {
+	return c.store("add", key, src, ttl, 0)
+}
+
+// Replace works like CompareAndSwap with the version of the current value,
+// retried until it succeeds. Tags of the current value are kept.
+func (c *Cache) Replace(key string, src interface{}, ttl time.Duration) error {
+	for {
+		if err := c.swap(key, src, nil, ttl); err != cache.ErrConflict {
+			return err
+		}
+	}
+}
+
+// CompareAndSwap store the value only if it was not changed. Tags of the
+// current value are kept.
+func (c *Cache) CompareAndSwap(key string, src interface{}, version uint64, ttl time.Duration) error {
+	return c.swap(key, src, &version, ttl)
+}
+
+// swap store the value if the current one exists and, if version is not nil,
+// is of given version.
+func (c *Cache) swap(key string, src interface{}, version *uint64, ttl time.Duration) error {
+	raw, current, err := c.getRaw(key)
+	if err != nil {
+		return err
+	}
+	if version != nil && *version != current {
+		return cache.ErrConflict
+	}
+	_, tags, err := c.open(raw)
+	if err != nil {
+		return err
+	}
+	return c.store("cas", key, src, ttl, current, tags...)
+}
+
+// store serialize value and execute one of the storage commands. Value is
+// stored together with current generations of counters covering it.
+func (c *Cache) store(verb, key string, src interface{}, ttl time.Duration, version uint64, tags ...string) error {
+	raw, err := c.opts.Codec.Marshal(src)
+	if err != nil {
+		return err
+	}
+	if !validKey(key) {
+		return ErrMalformedKey
+	}
+	keys := gens.Keys(key, tags, c.opts.Prefixes)
+	if len(tags) == 0 && gens.IsCounter(raw) {
+		// stored as is, so that it can be modified by Incr and Decr
+		keys = nil
+	}
+	current, err := c.generations(keys)
+	if err != nil {
+		return err
+	}
+	values := make([]int64, len(keys))
+	for i, k := range keys {
+		values[i] = current[k]
+	}
+	return c.storeRaw(verb, key, gens.Encode(raw, keys, values), ttl, version)
+}
+
+func (c *Cache) storeRaw(verb, key string, raw []byte, ttl time.Duration, version uint64) error {
+	return c.withConn(key, func(cn *conn) error {
+		if verb == "cas" {
+			fmt.Fprintf(cn.w, "cas %s 0 %d %d %d\r\n", key, expiration(ttl), len(raw), version)
+		} else {
+			fmt.Fprintf(cn.w, "%s %s 0 %d %d\r\n", verb, key, expiration(ttl), len(raw))
+		}
+		cn.w.Write(raw)
+		cn.w.WriteString("\r\n")
+		if err := cn.w.Flush(); err != nil {
+			return err
+		}
+
+		line, err := cn.readLine()
+		if err != nil {
+			return err
+		}
+		switch string(line) {
+		case "STORED":
+			return nil
+		case "NOT_STORED":
+			if verb == "add" {
+				return cache.ErrConflict
+			}
+			return cache.ErrNotFound
+		case "EXISTS":
+			return cache.ErrConflict
+		case "NOT_FOUND":
+			return cache.ErrNotFound
+		}
+		return replyError(line)
+	})
+}
+
+// Incr increment value stored under given key. Memcached counters are
+// unsigned, so the result is never below zero.
+func (c *Cache) Incr(key string, delta int64) (int64, error) {
+	if delta < 0 {
+		return c.incr("decr", key, uint64(-delta))
+	}
+	return c.incr("incr", key, uint64(delta))
+}
+
+// Decr decrement value stored under given key. Memcached counters are
+// unsigned, so the result is never below zero.
+func (c *Cache) Decr(key string, delta int64) (int64, error) {
+	if delta < 0 {
+		return c.incr("incr", key, uint64(-delta))
+	}
+	return c.incr("decr", key, uint64(delta))
+}
+
+func (c *Cache) incr(verb, key string, delta uint64) (int64, error) {
+	for {
+		var n uint64
+		err := c.withConn(key, func(cn *conn) error {
+			fmt.Fprintf(cn.w, "%s %s %d\r\n", verb, key, delta)
+			if err := cn.w.Flush(); err != nil {
+				return err
+			}
+			line, err := cn.readLine()
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(line, []byte("NOT_FOUND")) {
+				return cache.ErrNotFound
+			}
+			if bytes.HasPrefix(line, []byte("CLIENT_ERROR ")) && bytes.Contains(line, []byte("non-numeric")) {
+				return cache.ErrNotInteger
+			}
+			if n, err = strconv.ParseUint(string(line), 10, 64); err != nil {
+				return replyError(line)
+			}
+			return nil
+		})
+		if err != cache.ErrNotFound {
+			return int64(n), err
+		}
+
+		// counter does not exist yet and must be created, bypassing the
+		// codec, because memcached requires decimal representation
+		var initial uint64
+		if verb == "incr" {
+			initial = delta
+		}
+		switch err := c.storeRaw("add", key, strconv.AppendUint(nil, initial, 10), 0, 0); err {
+		case nil:
+			return int64(initial), nil
+		case cache.ErrConflict:
+			// created by another client in the meantime
+			continue
+		default:
+			return 0, err
+		}
+	}
+}
+
+func (c *Cache) Del(key string) error {
+	return c.withConn(key, func(cn *conn) error {
+		fmt.Fprintf(cn.w, "delete %s\r\n", key)
+		if err := cn.w.Flush(); err != nil {
+			return err
+		}
+		line, err := cn.readLine()
+		if err != nil {
+			return err
+		}
+		switch string(line) {
+		case "DELETED", "NOT_FOUND":
+			return nil
+		}
+		return replyError(line)
+	})
+}
+
+// InvalidateTag increment generation counter of given tag, making all values
+// tagged with it invalid.
+func (c *Cache) InvalidateTag(tag string) error {
+	_, err := c.Incr(gens.TagKey(tag), 1)
+	return err
+}
+
+// DelPrefix increment generation counter of given prefix, making all values
+// with key starting with the prefix invalid. See Opts.Prefixes. Counters
+// modified by Incr and Decr are not affected.
+func (c *Cache) DelPrefix(prefix string) error {
+	if !c.opts.Prefixes {
+		return cache.ErrNotSupported
+	}
+	if !strings.HasSuffix(prefix, ":") {
+		return cache.ErrInvalidPrefix
+	}
+	_, err := c.Incr(gens.PrefixKey(prefix), 1)
+	return err
+}
+
+// expiration return memcached expiration time for given TTL. Memcached
+// treats values longer than 30 days as unix timestamp.
+func expiration(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	// round up, so that short TTL does not become no expiration
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	if secs > maxRelativeExpiration {
+		return currentTime().Unix() + secs
+	}
+	return secs
+}
+
+const maxRelativeExpiration = 60 * 60 * 24 * 30
+
+// we want to mock current time in tests
+var currentTime = time.Now
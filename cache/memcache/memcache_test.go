@@ -0,0 +1,421 @@
+package memcache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/husio/x/cache"
+)
+
+func testCache(t *testing.T, nservers int) (*Cache, []*Server, func()) {
+	var servers []*Server
+	var addrs []string
+	for i := 0; i < nservers; i++ {
+		srv, err := StartServer()
+		if err != nil {
+			t.Fatalf("cannot start server: %s", err)
+		}
+		servers = append(servers, srv)
+		addrs = append(addrs, srv.Addr())
+	}
+	c := New(addrs, nil)
+	return c, servers, func() {
+		c.Close()
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c, _, done := testCache(t, 1)
+	defer done()
+
+	var val string
+	if err := c.Get("a", &val); err != cache.ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Put("a", "first"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.Get("a", &val); err != nil || val != "first" {
+		t.Fatalf("want first, got %q, %v", val, err)
+	}
+	if err := c.Del("a"); err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	if err := c.Del("a"); err != nil {
+		t.Fatalf("cannot delete missing: %s", err)
+	}
+	if err := c.Get("a", &val); err != cache.ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+
+	for _, key := range []string{"", "with space", "new\nline", strings.Repeat("x", 251)} {
+		if err := c.Put(key, 1); err != ErrMalformedKey {
+			t.Errorf("%q: want ErrMalformedKey, got %v", key, err)
+		}
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	defer func() { currentTime = time.Now }()
+
+	c, _, done := testCache(t, 1)
+	defer done()
+
+	if err := c.PutTTL("a", 1, time.Hour); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	var val int
+	if err := c.Get("a", &val); err != nil || val != 1 {
+		t.Fatalf("want 1, got %d, %v", val, err)
+	}
+
+	// long expiration is sent as timestamp, that is already in the past
+	currentTime = func() time.Time { return time.Now().Add(-32 * 24 * time.Hour) }
+	if err := c.PutTTL("a", 2, 31*24*time.Hour); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.Get("a", &val); err != cache.ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	defer func() { currentTime = time.Now }()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+
+	cases := map[time.Duration]int64{
+		0:                       0,
+		time.Millisecond:        1,
+		time.Second:             1,
+		1500 * time.Millisecond: 2,
+		time.Hour:               3600,
+		30 * 24 * time.Hour:     maxRelativeExpiration,
+		31 * 24 * time.Hour:     now.Unix() + 31*24*60*60,
+	}
+	for ttl, want := range cases {
+		if got := expiration(ttl); got != want {
+			t.Errorf("%s: want %d, got %d", ttl, want, got)
+		}
+	}
+}
+
+func TestCacheAtomicOperations(t *testing.T) {
+	c, _, done := testCache(t, 1)
+	defer done()
+
+	if err := c.Add("a", 1, 0); err != nil {
+		t.Fatalf("cannot add: %s", err)
+	}
+	if err := c.Add("a", 2, 0); err != cache.ErrConflict {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+	if err := c.Replace("b", 1, 0); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Replace("a", 3, 0); err != nil {
+		t.Fatalf("cannot replace: %s", err)
+	}
+
+	var val int
+	version, err := c.GetVersion("a", &val)
+	if err != nil || val != 3 {
+		t.Fatalf("want 3, got %d, %v", val, err)
+	}
+	if err := c.CompareAndSwap("a", 4, version, 0); err != nil {
+		t.Fatalf("cannot swap: %s", err)
+	}
+	if err := c.CompareAndSwap("a", 5, version, 0); err != cache.ErrConflict {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+	if err := c.CompareAndSwap("x", 5, version, 0); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Get("a", &val); err != nil || val != 4 {
+		t.Errorf("want 4, got %d, %v", val, err)
+	}
+
+	if n, err := c.Incr("counter", 5); err != nil || n != 5 {
+		t.Errorf("want 5, got %d, %v", n, err)
+	}
+	if n, err := c.Incr("counter", -2); err != nil || n != 3 {
+		t.Errorf("want 3, got %d, %v", n, err)
+	}
+	// counters are unsigned and cannot go below zero
+	if n, err := c.Decr("counter", 7); err != nil || n != 0 {
+		t.Errorf("want 0, got %d, %v", n, err)
+	}
+	if n, err := c.Decr("other", 7); err != nil || n != 0 {
+		t.Errorf("want 0, got %d, %v", n, err)
+	}
+	if err := c.Put("text", "abc"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if _, err := c.Incr("text", 1); err != cache.ErrNotInteger {
+		t.Errorf("want ErrNotInteger, got %v", err)
+	}
+}
+
+func TestCacheIncrKeepsTTL(t *testing.T) {
+	c, servers, done := testCache(t, 1)
+	defer done()
+
+	if err := c.Add("rate", 0, time.Minute); err != nil {
+		t.Fatalf("cannot add: %s", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if n, err := c.Incr("rate", 1); err != nil || n != int64(i) {
+			t.Fatalf("want %d, got %d, %v", i, n, err)
+		}
+	}
+	srv := servers[0]
+	srv.mu.Lock()
+	expires := srv.items["rate"].expires
+	srv.mu.Unlock()
+	if expires.IsZero() {
+		t.Error("want expiration time kept")
+	}
+}
+
+func TestCacheConcurrentIncr(t *testing.T) {
+	c, _, done := testCache(t, 1)
+	defer done()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := c.Incr("n", 1); err != nil {
+					t.Errorf("cannot increment: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var n int
+	if err := c.Get("n", &n); err != nil || n != 1000 {
+		t.Errorf("want 1000, got %d, %v", n, err)
+	}
+}
+
+func TestCacheMultipleServers(t *testing.T) {
+	c, servers, done := testCache(t, 3)
+	defer done()
+
+	for i := 0; i < 300; i++ {
+		if err := c.Put(fmt.Sprintf("key-%d", i), i); err != nil {
+			t.Fatalf("cannot put: %s", err)
+		}
+	}
+	total := 0
+	for i, srv := range servers {
+		n := srv.Len()
+		if n < 50 {
+			t.Errorf("server %d: want keys evenly distributed, got %d", i, n)
+		}
+		total += n
+	}
+	if total != 300 {
+		t.Errorf("want 300 keys, got %d", total)
+	}
+	for i := 0; i < 300; i++ {
+		var val int
+		if err := c.Get(fmt.Sprintf("key-%d", i), &val); err != nil || val != i {
+			t.Errorf("want %d, got %d, %v", i, val, err)
+		}
+	}
+}
+
+func TestRing(t *testing.T) {
+	addrs := []string{"10.0.0.1:11211", "10.0.0.2:11211", "10.0.0.3:11211", "10.0.0.4:11211"}
+	full := newRing(addrs, 100)
+	// last server removed
+	reduced := newRing(addrs[:3], 100)
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before, after := full.pick(key), reduced.pick(key)
+		if before != after {
+			if before != 3 {
+				t.Fatalf("%s: moved from %d to %d", key, before, after)
+			}
+			moved++
+		}
+	}
+	if moved < 150 || moved > 350 {
+		t.Errorf("want about quarter of keys moved, got %d", moved)
+	}
+}
+
+func TestCacheReconnect(t *testing.T) {
+	srv, err := StartServer()
+	if err != nil {
+		t.Fatalf("cannot start server: %s", err)
+	}
+	c := New([]string{srv.Addr()}, nil)
+	defer c.Close()
+
+	if err := c.Put("a", 1); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	srv.Close()
+
+	// pooled connection is broken and must be dropped
+	if err := c.Put("a", 2); err == nil {
+		t.Fatal("want error")
+	}
+	if n := len(c.servers[0].idle); n != 0 {
+		t.Errorf("want no idle connections, got %d", n)
+	}
+
+	c.Close()
+	if err := c.Put("a", 3); err != ErrClosed {
+		t.Errorf("want ErrClosed, got %v", err)
+	}
+}
+
+func TestCacheCodec(t *testing.T) {
+	srv, err := StartServer()
+	if err != nil {
+		t.Fatalf("cannot start server: %s", err)
+	}
+	defer srv.Close()
+	c := New([]string{srv.Addr()}, &Opts{Codec: cache.Gob})
+	defer c.Close()
+
+	created := time.Date(2016, 3, 4, 5, 6, 7, 8, time.FixedZone("X", 3600))
+	if err := c.Put("a", created); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	var got time.Time
+	if err := c.Get("a", &got); err != nil || !got.Equal(created) {
+		t.Fatalf("want %s, got %s, %v", created, got, err)
+	}
+
+	// counters are created as decimal text, regardless of the codec
+	if n, err := c.Incr("n", 2); err != nil || n != 2 {
+		t.Fatalf("want 2, got %d, %v", n, err)
+	}
+	if n, err := c.Incr("n", 2); err != nil || n != 4 {
+		t.Fatalf("want 4, got %d, %v", n, err)
+	}
+	rc := New([]string{srv.Addr()}, &Opts{Codec: cache.Raw})
+	defer rc.Close()
+	var raw []byte
+	if err := rc.Get("n", &raw); err != nil || string(raw) != "4" {
+		t.Fatalf("want 4, got %q, %v", raw, err)
+	}
+}
+
+func TestCacheTagsAndPrefix(t *testing.T) {
+	c, _, done := testCache(t, 3)
+	defer done()
+
+	if err := c.DelPrefix("account:"); err != cache.ErrNotSupported {
+		t.Errorf("want ErrNotSupported, got %v", err)
+	}
+	c.opts.Prefixes = true
+
+	if err := c.PutTagged("account:1:name", "bob", 0, "account:1"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.PutTagged("account:2:name", "ann", 0, "account:2"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.Put("account:2:email", "ann@example.com"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+
+	if err := c.InvalidateTag("account:1"); err != nil {
+		t.Fatalf("cannot invalidate: %s", err)
+	}
+	var s string
+	if err := c.Get("account:1:name", &s); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Get("account:2:name", &s); err != nil || s != "ann" {
+		t.Errorf("want ann, got %q, %v", s, err)
+	}
+
+	if err := c.DelPrefix("account:2"); err != cache.ErrInvalidPrefix {
+		t.Errorf("want ErrInvalidPrefix, got %v", err)
+	}
+	if err := c.DelPrefix("account:2:"); err != nil {
+		t.Fatalf("cannot delete prefix: %s", err)
+	}
+	for _, key := range []string{"account:2:name", "account:2:email"} {
+		if err := c.Get(key, &s); err != cache.ErrNotFound {
+			t.Errorf("%s: want ErrNotFound, got %v", key, err)
+		}
+	}
+
+	// compare and swap of value covered by counters
+	if err := c.PutTagged("account:3:name", "joe", 0, "account:3"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	version, err := c.GetVersion("account:3:name", &s)
+	if err != nil {
+		t.Fatalf("cannot get: %s", err)
+	}
+	if err := c.CompareAndSwap("account:3:name", "joe", version, 0); err != nil {
+		t.Fatalf("cannot swap: %s", err)
+	}
+	if err := c.Get("account:3:name", &s); err != nil || s != "joe" {
+		t.Errorf("want joe, got %q, %v", s, err)
+	}
+}
+
+func TestCacheNoServers(t *testing.T) {
+	c := New(nil, nil)
+	defer c.Close()
+
+	var s string
+	if err := c.Get("account:1", &s); err != ErrNoServers {
+		t.Errorf("want ErrNoServers, got %v", err)
+	}
+	if err := c.PutTagged("account:1", "bob", 0, "accounts"); err != ErrNoServers {
+		t.Errorf("want ErrNoServers, got %v", err)
+	}
+	if err := c.InvalidateTag("accounts"); err != ErrNoServers {
+		t.Errorf("want ErrNoServers, got %v", err)
+	}
+}
+
+func TestCacheOverwriteKeepsTags(t *testing.T) {
+	c, _, done := testCache(t, 1)
+	defer done()
+
+	if err := c.PutTagged("a", "v1", 0, "t"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.Replace("a", "v2", 0); err != nil {
+		t.Fatalf("cannot replace: %s", err)
+	}
+	var s string
+	version, err := c.GetVersion("a", &s)
+	if err != nil || s != "v2" {
+		t.Fatalf("want v2, got %q, %v", s, err)
+	}
+	if err := c.CompareAndSwap("a", "v3", version, 0); err != nil {
+		t.Fatalf("cannot swap: %s", err)
+	}
+	if err := c.InvalidateTag("t"); err != nil {
+		t.Fatalf("cannot invalidate: %s", err)
+	}
+	if err := c.Get("a", &s); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %q, %v", s, err)
+	}
+	if err := c.Replace("a", "v4", 0); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound replacing invalidated value, got %v", err)
+	}
+}
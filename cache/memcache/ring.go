@@ -0,0 +1,46 @@
+package memcache
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// ring implements consistent hashing. Every server is represented by several
+// points on the ring and key belongs to the server owning the first point
+// following the key hash.
+type ring []point
+
+type point struct {
+	hash   uint32
+	server int
+}
+
+func newRing(addrs []string, replicas int) ring {
+	r := make(ring, 0, len(addrs)*replicas)
+	for i, addr := range addrs {
+		for n := 0; n < replicas; n++ {
+			h := crc32.ChecksumIEEE([]byte(addr + "-" + strconv.Itoa(n)))
+			r = append(r, point{hash: h, server: i})
+		}
+	}
+	sort.Sort(r)
+	return r
+}
+
+func (r ring) Len() int           { return len(r) }
+func (r ring) Less(i, j int) bool { return r[i].hash < r[j].hash }
+func (r ring) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// pick return index of the server responsible for given key.
+func (r ring) pick(key string) int {
+	if len(r) == 0 {
+		return 0
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r), func(i int) bool { return r[i].hash >= h })
+	if i == len(r) {
+		i = 0
+	}
+	return r[i].server
+}
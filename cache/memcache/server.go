@@ -0,0 +1,306 @@
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is minimal, in memory implementation of the memcached server. It
+// supports only the subset of text protocol commands used by Cache and is
+// meant to be used in tests.
+type Server struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	items  map[string]*entry
+	cas    uint64
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type entry struct {
+	flags   uint32
+	val     []byte
+	expires time.Time
+	cas     uint64
+}
+
+// StartServer return running server, listening on random local port.
+func StartServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:    ln,
+		items: make(map[string]*entry),
+		conns: make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr return address server is listening on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Len return number of stored items, including expired ones that were not
+// accessed since they expired.
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// Close stop the server and close all client connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if !s.command(r, w, args) {
+			return
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// command execute single command. False is returned if connection must be
+// closed.
+func (s *Server) command(r *bufio.Reader, w *bufio.Writer, args []string) bool {
+	switch args[0] {
+	case "get", "gets":
+		s.mu.Lock()
+		for _, key := range args[1:] {
+			e, ok := s.lookup(key)
+			if !ok {
+				continue
+			}
+			if args[0] == "gets" {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, e.flags, len(e.val), e.cas)
+			} else {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, e.flags, len(e.val))
+			}
+			w.Write(e.val)
+			w.WriteString("\r\n")
+		}
+		s.mu.Unlock()
+		w.WriteString("END\r\n")
+	case "set", "add", "replace", "cas":
+		return s.store(r, w, args)
+	case "delete":
+		if len(args) != 2 {
+			w.WriteString("ERROR\r\n")
+			return true
+		}
+		s.mu.Lock()
+		if _, ok := s.lookup(args[1]); ok {
+			delete(s.items, args[1])
+			w.WriteString("DELETED\r\n")
+		} else {
+			w.WriteString("NOT_FOUND\r\n")
+		}
+		s.mu.Unlock()
+	case "incr", "decr":
+		if len(args) != 3 {
+			w.WriteString("ERROR\r\n")
+			return true
+		}
+		delta, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+			return true
+		}
+		s.mu.Lock()
+		s.incr(w, args[0], args[1], delta)
+		s.mu.Unlock()
+	case "flush_all":
+		s.mu.Lock()
+		s.items = make(map[string]*entry)
+		s.mu.Unlock()
+		w.WriteString("OK\r\n")
+	case "version":
+		w.WriteString("VERSION 1.6.0-fake\r\n")
+	case "quit":
+		return false
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return true
+}
+
+func (s *Server) store(r *bufio.Reader, w *bufio.Writer, args []string) bool {
+	// <command> <key> <flags> <exptime> <bytes> [<cas unique>]
+	n := 5
+	if args[0] == "cas" {
+		n = 6
+	}
+	if len(args) != n {
+		w.WriteString("ERROR\r\n")
+		return true
+	}
+	flags, err1 := strconv.ParseUint(args[2], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[3], 10, 64)
+	size, err3 := strconv.Atoi(args[4])
+	if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		// data block size is unknown, so it cannot be skipped
+		return false
+	}
+	var cas uint64
+	if args[0] == "cas" {
+		if cas, err1 = strconv.ParseUint(args[5], 10, 64); err1 != nil {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return false
+		}
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return false
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return false
+	}
+
+	key := args[1]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.lookup(key)
+	switch {
+	case args[0] == "add" && exists, args[0] == "replace" && !exists:
+		w.WriteString("NOT_STORED\r\n")
+		return true
+	case args[0] == "cas" && !exists:
+		w.WriteString("NOT_FOUND\r\n")
+		return true
+	case args[0] == "cas" && old.cas != cas:
+		w.WriteString("EXISTS\r\n")
+		return true
+	}
+
+	e := &entry{flags: uint32(flags), val: data[:size]}
+	switch {
+	case exptime < 0:
+		// already expired, nothing to store
+		delete(s.items, key)
+		w.WriteString("STORED\r\n")
+		return true
+	case exptime > maxRelativeExpiration:
+		e.expires = time.Unix(exptime, 0)
+	case exptime > 0:
+		e.expires = time.Now().Add(time.Duration(exptime) * time.Second)
+	}
+	s.set(key, e)
+	w.WriteString("STORED\r\n")
+	return true
+}
+
+// incr modify counter. Caller must hold the lock.
+func (s *Server) incr(w *bufio.Writer, verb, key string, delta uint64) {
+	e, ok := s.lookup(key)
+	if !ok {
+		w.WriteString("NOT_FOUND\r\n")
+		return
+	}
+	n, err := strconv.ParseUint(string(e.val), 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+		return
+	}
+	if verb == "incr" {
+		// overflow wraps around, as in memcached
+		n += delta
+	} else if delta > n {
+		// decrementing below zero results in zero
+		n = 0
+	} else {
+		n -= delta
+	}
+	s.set(key, &entry{
+		flags:   e.flags,
+		val:     strconv.AppendUint(nil, n, 10),
+		expires: e.expires,
+	})
+	fmt.Fprintf(w, "%d\r\n", n)
+}
+
+// lookup return not expired entry. Caller must hold the lock.
+func (s *Server) lookup(key string) (*entry, bool) {
+	e, ok := s.items[key]
+	if ok && !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(s.items, key)
+		return nil, false
+	}
+	return e, ok
+}
+
+// set store entry, assigning new CAS identifier. Caller must hold the lock.
+func (s *Server) set(key string, e *entry) {
+	s.cas++
+	e.cas = s.cas
+	s.items[key] = e
+}
@@ -0,0 +1,82 @@
+// Package pgnotify implements cache.Broadcaster using PostgreSQL LISTEN and
+// NOTIFY commands.
+package pgnotify
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+	"github.com/husio/x/storage/pg"
+)
+
+// Broadcaster publish messages using NOTIFY and receive them using dedicated
+// LISTEN connection.
+type Broadcaster struct {
+	db      pg.Execer
+	dsn     string
+	channel string
+}
+
+var _ cache.Broadcaster = (*Broadcaster)(nil)
+
+// New return broadcaster using given channel name. Messages are published
+// using db, while every subscription opens new connection using dsn.
+func New(db pg.Execer, dsn, channel string) *Broadcaster {
+	return &Broadcaster{db: db, dsn: dsn, channel: channel}
+}
+
+// Publish send message to all listeners. Message is delivered only if it
+// does not exceed 8000 bytes.
+func (b *Broadcaster) Publish(msg string) error {
+	_, err := b.db.Exec(`SELECT pg_notify($1, $2)`, b.channel, msg)
+	return pg.CastErr(err)
+}
+
+// Subscribe return channel receiving all published messages. Connection is
+// reestablished when broken and empty message is sent to notify about
+// possibly lost messages.
+func (b *Broadcaster) Subscribe(ctx context.Context) (<-chan string, error) {
+	l := pq.NewListener(b.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("pg listener error: %s", err)
+		}
+	})
+	if err := l.Listen(b.channel); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	msgs := make(chan string, 64)
+	go func() {
+		defer close(msgs)
+		defer l.Close()
+
+		for {
+			var msg string
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-l.Notify:
+				// nil notification is sent after reconnecting
+				if n != nil {
+					msg = n.Extra
+				}
+			case <-time.After(90 * time.Second):
+				// make sure connection is still alive
+				go l.Ping()
+				continue
+			}
+
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return msgs, nil
+}
@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/husio/x/cache"
+	"github.com/husio/x/cache/internal/gens"
+)
+
+// Pipeline collects commands that are sent to the server at once, saving the
+// round trip time of every but first command.
+//
+// Pipeline is not a transaction, commands of other clients can be executed
+// in between.
+type Pipeline struct {
+	c     *Cache
+	cmds  []*pipelineCmd
+	dests []interface{}
+	errs  []error
+}
+
+type pipelineCmd struct {
+	// op defines how the reply is decoded
+	op   pipelineOp
+	args []interface{}
+	// set commands are built when executed, because they require current
+	// generations of counters covering the value
+	set *pipelineSet
+}
+
+type pipelineOp uint8
+
+const (
+	opGet pipelineOp = iota
+	opSet
+	opDel
+	opIncr
+)
+
+type pipelineSet struct {
+	key  string
+	raw  []byte
+	keys []string
+	ttl  time.Duration
+}
+
+// Pipeline return new, empty pipeline.
+func (c *Cache) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+func (p *Pipeline) add(cmd *pipelineCmd, dest interface{}, err error) {
+	p.cmds = append(p.cmds, cmd)
+	p.dests = append(p.dests, dest)
+	p.errs = append(p.errs, err)
+}
+
+// Get queue loading value into dest.
+func (p *Pipeline) Get(key string, dest interface{}) {
+	p.add(&pipelineCmd{op: opGet, args: []interface{}{"GET", key}}, dest, nil)
+}
+
+// Put queue storing value without expiration.
+func (p *Pipeline) Put(key string, src interface{}) {
+	p.PutTTL(key, src, 0)
+}
+
+// PutTTL queue storing value that expires after given time.
+func (p *Pipeline) PutTTL(key string, src interface{}, ttl time.Duration) {
+	p.PutTagged(key, src, ttl)
+}
+
+// PutTagged queue storing tagged value that expires after given time.
+func (p *Pipeline) PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) {
+	raw, err := p.c.opts.Codec.Marshal(src)
+	set := &pipelineSet{key: key, raw: raw, keys: p.c.counters(key, raw, tags), ttl: ttl}
+	p.add(&pipelineCmd{op: opSet, set: set}, nil, err)
+}
+
+// Del queue removing value.
+func (p *Pipeline) Del(key string) {
+	p.add(&pipelineCmd{op: opDel, args: []interface{}{"DEL", key}}, nil, nil)
+}
+
+// Incr queue incrementing integer value. Result is loaded into dest, that
+// must be *int64 or nil.
+func (p *Pipeline) Incr(key string, delta int64, dest *int64) {
+	p.add(&pipelineCmd{op: opIncr, args: []interface{}{"INCRBY", key, delta}}, dest, nil)
+}
+
+// Exec send all queued commands and wait for their results. Returned slice
+// contains result of every queued command, in the order they were added. Get
+// of missing value results in cache.ErrNotFound.
+//
+// Error is returned only if commands could not be executed, for example
+// because of network failure.
+func (p *Pipeline) Exec() ([]error, error) {
+	queued, errs, dests := p.cmds, p.errs, p.dests
+	p.cmds, p.dests, p.errs = nil, nil, nil
+
+	var idx []int
+	var genKeys []string
+	for i, cmd := range queued {
+		if errs[i] == nil {
+			idx = append(idx, i)
+			if cmd.set != nil {
+				genKeys = append(genKeys, cmd.set.keys...)
+			}
+		}
+	}
+	if len(idx) == 0 {
+		return errs, nil
+	}
+
+	current, err := p.c.generations(genKeys)
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([][]interface{}, len(idx))
+	for n, i := range idx {
+		if set := queued[i].set; set != nil {
+			cmds[n] = setCmd(set.key, envelope(set.raw, set.keys, current), set.ttl)
+		} else {
+			cmds[n] = queued[i].args
+		}
+	}
+
+	replies, err := p.c.do(cmds...)
+	if err != nil {
+		return nil, err
+	}
+
+	// values are decoded once all generations they depend on are known
+	type loaded struct {
+		i      int
+		value  []byte
+		keys   []string
+		stored []int64
+	}
+	var values []loaded
+	genKeys = nil
+	for n, rep := range replies {
+		i := idx[n]
+		if e, ok := rep.(Error); ok {
+			errs[i] = e
+			continue
+		}
+		switch queued[i].op {
+		case opSet, opDel:
+		case opIncr:
+			v, ok := rep.(int64)
+			if !ok {
+				errs[i] = errProtocol
+			} else if dest := dests[i].(*int64); dest != nil {
+				*dest = v
+			}
+		case opGet:
+			raw, ok := rep.([]byte)
+			if !ok {
+				if rep == nil {
+					errs[i] = cache.ErrNotFound
+				} else {
+					errs[i] = errProtocol
+				}
+				continue
+			}
+			value, keys, stored, err := gens.Decode(raw)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			values = append(values, loaded{i: i, value: value, keys: keys, stored: stored})
+			genKeys = append(genKeys, keys...)
+		}
+	}
+
+	if current, err = p.c.generations(genKeys); err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if !gens.Valid(v.keys, v.stored, current) {
+			errs[v.i] = cache.ErrNotFound
+		} else {
+			errs[v.i] = p.c.opts.Codec.Unmarshal(v.value, dests[v.i])
+		}
+	}
+	return errs, nil
+}
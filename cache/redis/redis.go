@@ -0,0 +1,578 @@
+// Package redis implements cache.Cache backed by Redis compatible server.
+//
+// Client is using only the standard library and speaks RESP protocol
+// directly. Connections are pooled and multiple commands can be sent at once
+// using Pipeline.
+//
+// Tags and prefix invalidation are emulated using generation counters stored
+// on the server. Invalidated values are not removed, but ignored until they
+// expire or are overwritten. Prefix invalidation is costly and must be
+// enabled, see Opts.Prefixes.
+//
+// Package provides minimal, in memory Server implementation, that can be used
+// for testing without running the real Redis instance.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+	"github.com/husio/x/cache/internal/gens"
+)
+
+// Opts defines connection settings.
+type Opts struct {
+	// Network defaults to "tcp".
+	Network string
+	// MaxIdle is the maximum number of idle connections kept in the pool.
+	// Defaults to 8.
+	MaxIdle int
+	// DialTimeout defaults to 5 seconds.
+	DialTimeout time.Duration
+	// Timeout is the read and write deadline of every operation. Defaults
+	// to 3 seconds.
+	Timeout time.Duration
+	// Codec is used to serialize values. Defaults to cache.JSON. Counters
+	// modified by Incr and Decr are always stored as decimal text, that can
+	// be read using cache.JSON or cache.Raw codec only. Integer values
+	// stored without tags can be modified by Incr and Decr.
+	Codec cache.Codec
+	// Prefixes enables DelPrefix, that otherwise return
+	// cache.ErrNotSupported. Every value with key containing ':' separator
+	// is then stored together with generations of all its prefixes, that
+	// must be read from the server when the value is written and read,
+	// costing an additional round trip.
+	Prefixes bool
+}
+
+// Cache is cache.Cache implementation using Redis server as the storage.
+type Cache struct {
+	addr string
+	opts Opts
+	pool *pool
+	// ctx, if set, limits the time of every operation
+	ctx context.Context
+	// parent is the cache this one was bound to the context from
+	parent *Cache
+}
+
+type pool struct {
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+var (
+	_ cache.Cache     = (*Cache)(nil)
+	_ cache.Unwrapper = (*Cache)(nil)
+)
+
+// New return cache using Redis server at given address. Connections are
+// created lazily.
+func New(addr string, o *Opts) *Cache {
+	if o == nil {
+		o = &Opts{}
+	}
+	opts := *o
+	if opts.Network == "" {
+		opts.Network = "tcp"
+	}
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = 8
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Second
+	}
+	if opts.Codec == nil {
+		opts.Codec = cache.JSON
+	}
+	return &Cache{addr: addr, opts: opts, pool: &pool{}}
+}
+
+// WithContext return cache sharing connections with c, that is executing
+// operations with deadline of given context, if it is earlier than the
+// timeout.
+func (c *Cache) WithContext(ctx context.Context) cache.Cache {
+	cc := *c
+	cc.ctx = ctx
+	if cc.parent == nil {
+		cc.parent = c
+	}
+	return &cc
+}
+
+// Unwrap return the cache this one was bound to the context from, or nil.
+func (c *Cache) Unwrap() cache.Cache {
+	if c.parent == nil {
+		return nil
+	}
+	return c.parent
+}
+
+// deadline return time until which current operation must finish.
+func (c *Cache) deadline() time.Time {
+	deadline := time.Now().Add(c.opts.Timeout)
+	if c.ctx != nil {
+		if d, ok := c.ctx.Deadline(); ok && d.Before(deadline) {
+			return d
+		}
+	}
+	return deadline
+}
+
+// Close close all idle connections. Cache cannot be used after closing.
+func (c *Cache) Close() error {
+	p := c.pool
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	var err error
+	for _, cn := range idle {
+		if e := cn.nc.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ErrClosed is returned when using closed cache.
+var ErrClosed = errors.New("redis: cache closed")
+
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	w  *bufio.Writer
+}
+
+// get return idle connection from the pool or create new one.
+func (c *Cache) get() (*conn, error) {
+	if c.ctx != nil {
+		if err := c.ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	p := c.pool
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(p.idle); n > 0 {
+		cn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return cn, nil
+	}
+	p.mu.Unlock()
+
+	dialer := net.Dialer{Timeout: c.opts.DialTimeout, Deadline: c.deadline()}
+	nc, err := dialer.Dial(c.opts.Network, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{
+		nc: nc,
+		r:  bufio.NewReader(nc),
+		w:  bufio.NewWriter(nc),
+	}, nil
+}
+
+// put return connection to the pool. Connections that failed must not be
+// reused, because their state is unknown.
+func (c *Cache) put(cn *conn, failed bool) {
+	p := c.pool
+	p.mu.Lock()
+	if !failed && !p.closed && len(p.idle) < c.opts.MaxIdle {
+		p.idle = append(p.idle, cn)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	cn.nc.Close()
+}
+
+// do send all given commands at once and return their replies. Error reply is
+// returned as the Error value, not as an error.
+func (c *Cache) do(cmds ...[]interface{}) ([]interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.do(c.deadline(), cmds...)
+	c.put(cn, err != nil)
+	return replies, err
+}
+
+func (cn *conn) do(deadline time.Time, cmds ...[]interface{}) ([]interface{}, error) {
+	if err := cn.nc.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		if err := writeCommand(cn.w, cmd...); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range replies {
+		var err error
+		if replies[i], err = readReply(cn.r); err != nil {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+// do1 send single command and return its reply. Error reply is returned as an
+// error.
+func (c *Cache) do1(args ...interface{}) (interface{}, error) {
+	replies, err := c.do(args)
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := replies[0].(Error); ok {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Codec return codec used to serialize values.
+func (c *Cache) Codec() cache.Codec {
+	return c.opts.Codec
+}
+
+func (c *Cache) Get(key string, dest interface{}) error {
+	_, err := c.GetVersion(key, dest)
+	return err
+}
+
+// GetVersion works like Get, but additionally return version of the value.
+// Version is computed from the value content.
+func (c *Cache) GetVersion(key string, dest interface{}) (uint64, error) {
+	rep, err := c.do1("GET", key)
+	if err != nil {
+		return 0, err
+	}
+	return c.decode(rep, dest)
+}
+
+func (c *Cache) decode(rep interface{}, dest interface{}) (uint64, error) {
+	switch raw := rep.(type) {
+	case nil:
+		return 0, cache.ErrNotFound
+	case []byte:
+		value, _, err := c.open(raw)
+		if err != nil {
+			return 0, err
+		}
+		return version(raw), c.opts.Codec.Unmarshal(value, dest)
+	default:
+		return 0, errProtocol
+	}
+}
+
+// open return value stored in the envelope and tags it was stored with.
+// cache.ErrNotFound is returned if the value was invalidated.
+func (c *Cache) open(raw []byte) ([]byte, []string, error) {
+	value, keys, stored, err := gens.Decode(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keys) > 0 {
+		current, err := c.generations(keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !gens.Valid(keys, stored, current) {
+			return nil, nil, cache.ErrNotFound
+		}
+	}
+	return value, gens.Tags(keys), nil
+}
+
+// generations return current values of given generation counters.
+func (c *Cache) generations(keys []string) (map[string]int64, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	rep, err := c.do1(args...)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := rep.([]interface{})
+	if !ok || len(values) != len(keys) {
+		return nil, errProtocol
+	}
+	current := make(map[string]int64, len(keys))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			// missing counter is zero
+		case []byte:
+			n, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return nil, errProtocol
+			}
+			current[keys[i]] = n
+		default:
+			return nil, errProtocol
+		}
+	}
+	return current, nil
+}
+
+func version(raw []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(raw)
+	return h.Sum64()
+}
+
+func (c *Cache) Put(key string, src interface{}) error {
+	return c.PutTTL(key, src, 0)
+}
+
+func (c *Cache) PutTTL(key string, src interface{}, ttl time.Duration) error {
+	return c.PutTagged(key, src, ttl)
+}
+
+func (c *Cache) PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) error {
+	cmd, err := c.setCmd(key, src, ttl, tags)
+	if err != nil {
+		return err
+	}
+	_, err = c.do1(cmd...)
+	return err
+}
+
+func (c *Cache) Add(key string, src interface{}, ttl time.Duration) error {
+	cmd, err := c.setCmd(key, src, ttl, nil, "NX")
+	if err != nil {
+		return err
+	}
+	rep, err := c.do1(cmd...)
+	if err != nil {
+		return err
+	}
+	if rep == nil {
+		return cache.ErrConflict
+	}
+	return nil
+}
+
+// Replace works like CompareAndSwap with the version of the current value,
+// retried until it succeeds. Tags of the current value are kept.
+func (c *Cache) Replace(key string, src interface{}, ttl time.Duration) error {
+	for {
+		if err := c.swap(key, src, nil, ttl); err != cache.ErrConflict {
+			return err
+		}
+	}
+}
+
+// CompareAndSwap is using optimistic locking with WATCH command to store the
+// value only if it was not changed. Tags of the current value are kept.
+func (c *Cache) CompareAndSwap(key string, src interface{}, ver uint64, ttl time.Duration) error {
+	return c.swap(key, src, &ver, ttl)
+}
+
+// swap store the value if the current one exists and, if ver is not nil, is
+// of given version.
+func (c *Cache) swap(key string, src interface{}, ver *uint64, ttl time.Duration) error {
+	cn, err := c.get()
+	if err != nil {
+		return err
+	}
+	err = c.cas(cn, key, src, ver, ttl)
+	switch err {
+	case nil, cache.ErrNotFound, cache.ErrConflict:
+		c.put(cn, false)
+	default:
+		c.put(cn, true)
+	}
+	return err
+}
+
+func (c *Cache) cas(cn *conn, key string, src interface{}, ver *uint64, ttl time.Duration) error {
+	replies, err := cn.do(c.deadline(),
+		[]interface{}{"WATCH", key},
+		[]interface{}{"GET", key})
+	if err != nil {
+		return err
+	}
+	if err, ok := replies[0].(Error); ok {
+		return err
+	}
+
+	var current []byte
+	switch raw := replies[1].(type) {
+	case nil:
+		return c.unwatch(cn, cache.ErrNotFound)
+	case []byte:
+		current = raw
+	case Error:
+		return raw
+	default:
+		return errProtocol
+	}
+	if ver != nil && version(current) != *ver {
+		return c.unwatch(cn, cache.ErrConflict)
+	}
+	_, tags, err := c.open(current)
+	if err != nil {
+		return c.unwatch(cn, err)
+	}
+	set, err := c.setCmd(key, src, ttl, tags)
+	if err != nil {
+		return c.unwatch(cn, err)
+	}
+
+	replies, err = cn.do(c.deadline(),
+		[]interface{}{"MULTI"},
+		set,
+		[]interface{}{"EXEC"})
+	if err != nil {
+		return err
+	}
+	switch rep := replies[2].(type) {
+	case nil:
+		// transaction aborted, because watched key was modified
+		return cache.ErrConflict
+	case Error:
+		return rep
+	case []interface{}:
+		if len(rep) == 1 {
+			if err, ok := rep[0].(Error); ok {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errProtocol
+	}
+}
+
+// unwatch cancel the WATCH command and return given error.
+func (c *Cache) unwatch(cn *conn, err error) error {
+	if _, e := cn.do(c.deadline(), []interface{}{"UNWATCH"}); e != nil {
+		return e
+	}
+	return err
+}
+
+func (c *Cache) Incr(key string, delta int64) (int64, error) {
+	return c.incr("INCRBY", key, delta)
+}
+
+func (c *Cache) Decr(key string, delta int64) (int64, error) {
+	return c.incr("DECRBY", key, delta)
+}
+
+func (c *Cache) incr(cmd, key string, delta int64) (int64, error) {
+	rep, err := c.do1(cmd, key, delta)
+	if err != nil {
+		if strings.Contains(err.Error(), "not an integer") {
+			return 0, cache.ErrNotInteger
+		}
+		return 0, err
+	}
+	n, ok := rep.(int64)
+	if !ok {
+		return 0, errProtocol
+	}
+	return n, nil
+}
+
+func (c *Cache) Del(key string) error {
+	_, err := c.do1("DEL", key)
+	return err
+}
+
+// InvalidateTag increment generation counter of given tag, making all values
+// tagged with it invalid.
+func (c *Cache) InvalidateTag(tag string) error {
+	_, err := c.do1("INCR", gens.TagKey(tag))
+	return err
+}
+
+// DelPrefix increment generation counter of given prefix, making all values
+// with key starting with the prefix invalid. See InvalidateTag and
+// Opts.Prefixes. Counters modified by Incr and Decr are not affected.
+func (c *Cache) DelPrefix(prefix string) error {
+	if !c.opts.Prefixes {
+		return cache.ErrNotSupported
+	}
+	if !strings.HasSuffix(prefix, ":") {
+		return cache.ErrInvalidPrefix
+	}
+	_, err := c.do1("INCR", gens.PrefixKey(prefix))
+	return err
+}
+
+// setCmd return SET command storing serialized value together with current
+// generations of counters covering it.
+func (c *Cache) setCmd(key string, src interface{}, ttl time.Duration, tags []string, flags ...interface{}) ([]interface{}, error) {
+	raw, err := c.opts.Codec.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	keys := c.counters(key, raw, tags)
+	current, err := c.generations(keys)
+	if err != nil {
+		return nil, err
+	}
+	return setCmd(key, envelope(raw, keys, current), ttl, flags...), nil
+}
+
+// counters return names of generation counters covering serialized value
+// stored under given key.
+func (c *Cache) counters(key string, raw []byte, tags []string) []string {
+	if len(tags) == 0 && gens.IsCounter(raw) {
+		// stored as is, so that it can be modified by Incr and Decr
+		return nil
+	}
+	return gens.Keys(key, tags, c.opts.Prefixes)
+}
+
+// envelope return value wrapped together with generations of given counters.
+func envelope(raw []byte, keys []string, current map[string]int64) []byte {
+	values := make([]int64, len(keys))
+	for i, key := range keys {
+		values[i] = current[key]
+	}
+	return gens.Encode(raw, keys, values)
+}
+
+func setCmd(key string, value []byte, ttl time.Duration, flags ...interface{}) []interface{} {
+	cmd := []interface{}{"SET", key, value}
+	if ttl > 0 {
+		ms := int64(ttl / time.Millisecond)
+		if ms == 0 {
+			ms = 1
+		}
+		cmd = append(cmd, "PX", ms)
+	}
+	return append(cmd, flags...)
+}
@@ -0,0 +1,437 @@
+package redis
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+)
+
+func testCache(t *testing.T) (*Cache, func()) {
+	srv, err := StartServer()
+	if err != nil {
+		t.Fatalf("cannot start server: %s", err)
+	}
+	c := New(srv.Addr(), nil)
+	return c, func() {
+		c.Close()
+		srv.Close()
+	}
+}
+
+func TestCache(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	var val string
+	if err := c.Get("a", &val); err != cache.ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Put("a", "first"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.Get("a", &val); err != nil || val != "first" {
+		t.Fatalf("want first, got %q, %v", val, err)
+	}
+	if err := c.Del("a"); err != nil {
+		t.Fatalf("cannot delete: %s", err)
+	}
+	if err := c.Get("a", &val); err != cache.ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if err := c.PutTTL("a", 1, 20*time.Millisecond); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	var val int
+	if err := c.Get("a", &val); err != nil || val != 1 {
+		t.Fatalf("want 1, got %d, %v", val, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := c.Get("a", &val); err != cache.ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestCacheAtomicOperations(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if err := c.Add("a", 1, 0); err != nil {
+		t.Fatalf("cannot add: %s", err)
+	}
+	if err := c.Add("a", 2, 0); err != cache.ErrConflict {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+	if err := c.Replace("b", 1, 0); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Replace("a", 3, 0); err != nil {
+		t.Fatalf("cannot replace: %s", err)
+	}
+
+	var val int
+	version, err := c.GetVersion("a", &val)
+	if err != nil || val != 3 {
+		t.Fatalf("want 3, got %d, %v", val, err)
+	}
+	if err := c.CompareAndSwap("a", 4, version, 0); err != nil {
+		t.Fatalf("cannot swap: %s", err)
+	}
+	if err := c.CompareAndSwap("a", 5, version, 0); err != cache.ErrConflict {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+	if err := c.CompareAndSwap("x", 5, version, 0); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Get("a", &val); err != nil || val != 4 {
+		t.Errorf("want 4, got %d, %v", val, err)
+	}
+
+	if n, err := c.Incr("counter", 5); err != nil || n != 5 {
+		t.Errorf("want 5, got %d, %v", n, err)
+	}
+	if n, err := c.Decr("counter", 7); err != nil || n != -2 {
+		t.Errorf("want -2, got %d, %v", n, err)
+	}
+	if err := c.Get("counter", &val); err != nil || val != -2 {
+		t.Errorf("want -2, got %d, %v", val, err)
+	}
+	if err := c.Put("text", "abc"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if _, err := c.Incr("text", 1); err != cache.ErrNotInteger {
+		t.Errorf("want ErrNotInteger, got %v", err)
+	}
+}
+
+func TestCacheIncrKeepsTTL(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if err := c.Add("rate", 0, 30*time.Millisecond); err != nil {
+		t.Fatalf("cannot add: %s", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if n, err := c.Incr("rate", 1); err != nil || n != int64(i) {
+			t.Fatalf("want %d, got %d, %v", i, n, err)
+		}
+	}
+	time.Sleep(40 * time.Millisecond)
+	var val int
+	if err := c.Get("rate", &val); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+
+	p := c.Pipeline()
+	p.PutTTL("rate", 10, time.Minute)
+	if _, err := p.Exec(); err != nil {
+		t.Fatalf("cannot execute: %s", err)
+	}
+	if n, err := c.Incr("rate", 1); err != nil || n != 11 {
+		t.Errorf("want 11, got %d, %v", n, err)
+	}
+}
+
+func TestCacheConcurrentIncr(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := c.Incr("n", 1); err != nil {
+					t.Errorf("cannot increment: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var n int
+	if err := c.Get("n", &n); err != nil || n != 1000 {
+		t.Errorf("want 1000, got %d, %v", n, err)
+	}
+	if idle := len(c.pool.idle); idle > c.opts.MaxIdle {
+		t.Errorf("want at most %d idle connections, got %d", c.opts.MaxIdle, idle)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if err := c.Put("a", "x"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+
+	var a, missing string
+	var n int64
+	p := c.Pipeline()
+	p.Get("a", &a)
+	p.Get("missing", &missing)
+	p.PutTTL("b", "y", time.Minute)
+	p.Incr("counter", 3, &n)
+	p.Put("invalid", make(chan int))
+	p.Del("a")
+	errs, err := p.Exec()
+	if err != nil {
+		t.Fatalf("cannot execute: %s", err)
+	}
+
+	if errs[0] != nil || a != "x" {
+		t.Errorf("want x, got %q, %v", a, errs[0])
+	}
+	if errs[1] != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", errs[1])
+	}
+	if errs[2] != nil {
+		t.Errorf("cannot put: %s", errs[2])
+	}
+	if errs[3] != nil || n != 3 {
+		t.Errorf("want 3, got %d, %v", n, errs[3])
+	}
+	if errs[4] == nil {
+		t.Error("want marshal error")
+	}
+	if errs[5] != nil {
+		t.Errorf("cannot delete: %s", errs[5])
+	}
+
+	var b string
+	if err := c.Get("b", &b); err != nil || b != "y" {
+		t.Errorf("want y, got %q, %v", b, err)
+	}
+	if err := c.Get("a", &a); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestCacheReconnect(t *testing.T) {
+	srv, err := StartServer()
+	if err != nil {
+		t.Fatalf("cannot start server: %s", err)
+	}
+	c := New(srv.Addr(), nil)
+	defer c.Close()
+
+	if err := c.Put("a", 1); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	srv.Close()
+
+	// pooled connection is broken and must be dropped
+	if err := c.Put("a", 2); err == nil {
+		t.Fatal("want error")
+	}
+	if n := len(c.pool.idle); n != 0 {
+		t.Errorf("want no idle connections, got %d", n)
+	}
+
+	c.Close()
+	if err := c.Put("a", 3); err != ErrClosed {
+		t.Errorf("want ErrClosed, got %v", err)
+	}
+}
+
+func TestCacheCodec(t *testing.T) {
+	srv, err := StartServer()
+	if err != nil {
+		t.Fatalf("cannot start server: %s", err)
+	}
+	defer srv.Close()
+	c := New(srv.Addr(), &Opts{Codec: cache.Compress(cache.Gob, 64)})
+	defer c.Close()
+
+	want := strings.Repeat("long value ", 100)
+	if err := c.Put("a", want); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	var got string
+	if err := c.Get("a", &got); err != nil || got != want {
+		t.Fatalf("cannot get: %v", err)
+	}
+
+	p := c.Pipeline()
+	p.Get("a", &got)
+	errs, err := p.Exec()
+	if err != nil || errs[0] != nil || got != want {
+		t.Fatalf("cannot get: %v, %v", err, errs)
+	}
+}
+
+func TestCacheTagsAndPrefix(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if err := c.DelPrefix("account:"); err != cache.ErrNotSupported {
+		t.Errorf("want ErrNotSupported, got %v", err)
+	}
+	c.opts.Prefixes = true
+
+	if err := c.PutTagged("account:1:name", "bob", 0, "account:1"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.PutTagged("account:2:name", "ann", 0, "account:2"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.Put("account:2:email", "ann@example.com"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+
+	if err := c.InvalidateTag("account:1"); err != nil {
+		t.Fatalf("cannot invalidate: %s", err)
+	}
+	var s string
+	if err := c.Get("account:1:name", &s); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Get("account:2:name", &s); err != nil || s != "ann" {
+		t.Errorf("want ann, got %q, %v", s, err)
+	}
+
+	if err := c.DelPrefix("account:2"); err != cache.ErrInvalidPrefix {
+		t.Errorf("want ErrInvalidPrefix, got %v", err)
+	}
+	if err := c.DelPrefix("account:2:"); err != nil {
+		t.Fatalf("cannot delete prefix: %s", err)
+	}
+	p := c.Pipeline()
+	p.Get("account:2:name", &s)
+	p.Get("account:2:email", &s)
+	errs, err := p.Exec()
+	if err != nil {
+		t.Fatalf("cannot execute: %s", err)
+	}
+	for i, err := range errs {
+		if err != cache.ErrNotFound {
+			t.Errorf("%d: want ErrNotFound, got %v", i, err)
+		}
+	}
+
+	// new values are not affected by previous invalidation
+	p.PutTagged("account:2:name", "ann", 0, "account:2")
+	if errs, err := p.Exec(); err != nil || errs[0] != nil {
+		t.Fatalf("cannot put: %v, %v", err, errs)
+	}
+	if err := c.Get("account:2:name", &s); err != nil || s != "ann" {
+		t.Errorf("want ann, got %q, %v", s, err)
+	}
+}
+
+func TestCacheWithContext(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.WithContext(ctx).Put("a", 1); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	var val int
+	if err := c.WithContext(ctx).Get("a", &val); err != nil || val != 1 {
+		t.Fatalf("want 1, got %d, %v", val, err)
+	}
+
+	cancel()
+	if err := c.WithContext(ctx).Get("a", &val); err != context.Canceled {
+		t.Errorf("want Canceled, got %v", err)
+	}
+	// canceled context must not affect the original cache
+	if err := c.Get("a", &val); err != nil {
+		t.Errorf("cannot get: %s", err)
+	}
+}
+
+func TestPipelineGetInteger(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if err := c.Put("n", 42); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	var n, counter int64
+	p := c.Pipeline()
+	p.Get("n", &n)
+	p.Incr("counter", 2, &counter)
+	p.Incr("counter", 1, nil)
+	errs, err := p.Exec()
+	if err != nil {
+		t.Fatalf("cannot execute: %s", err)
+	}
+	if errs[0] != nil || n != 42 {
+		t.Errorf("want 42, got %d, %v", n, errs[0])
+	}
+	if errs[1] != nil || counter != 2 || errs[2] != nil {
+		t.Errorf("want 2, got %d, %v", counter, errs)
+	}
+}
+
+func TestCacheUnwrap(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	ctx := context.Background()
+	bound := c.WithContext(ctx).(*Cache).WithContext(ctx)
+	if u := bound.(cache.Unwrapper).Unwrap(); u != cache.Cache(c) {
+		t.Errorf("want original cache, got %v", u)
+	}
+	if u := c.Unwrap(); u != nil {
+		t.Errorf("want nil, got %v", u)
+	}
+}
+
+func TestCacheOverwriteKeepsTags(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if err := c.PutTagged("a", "v1", 0, "t"); err != nil {
+		t.Fatalf("cannot put: %s", err)
+	}
+	if err := c.Replace("a", "v2", 0); err != nil {
+		t.Fatalf("cannot replace: %s", err)
+	}
+	var s string
+	version, err := c.GetVersion("a", &s)
+	if err != nil || s != "v2" {
+		t.Fatalf("want v2, got %q, %v", s, err)
+	}
+	if err := c.CompareAndSwap("a", "v3", version, 0); err != nil {
+		t.Fatalf("cannot swap: %s", err)
+	}
+	if err := c.InvalidateTag("t"); err != nil {
+		t.Fatalf("cannot invalidate: %s", err)
+	}
+	if err := c.Get("a", &s); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound, got %q, %v", s, err)
+	}
+	if err := c.Replace("a", "v4", 0); err != cache.ErrNotFound {
+		t.Errorf("want ErrNotFound replacing invalidated value, got %v", err)
+	}
+}
+
+func TestCacheFromContext(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(cache.WithCache(context.Background(), c), time.Millisecond)
+	defer cancel()
+	time.Sleep(2 * time.Millisecond)
+
+	var s string
+	if err := cache.Get(ctx).Get("a", &s); err != context.DeadlineExceeded {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,377 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is minimal, in memory implementation of the Redis server. It
+// supports only the subset of commands used by Cache and is meant to be used
+// in tests.
+type Server struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	data     map[string]*entry
+	versions map[string]uint64
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+type entry struct {
+	val     []byte
+	expires time.Time
+}
+
+// StartServer return running server, listening on random local port.
+func StartServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:       ln,
+		data:     make(map[string]*entry),
+		versions: make(map[string]uint64),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr return address server is listening on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close stop the server and close all client connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+// Flush remove all stored data.
+func (s *Server) Flush() {
+	s.mu.Lock()
+	for key := range s.data {
+		s.versions[key]++
+	}
+	s.data = make(map[string]*entry)
+	s.mu.Unlock()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+// client holds per connection transaction state.
+type client struct {
+	watched map[string]uint64
+	multi   bool
+	queued  [][][]byte
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	cl := &client{}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.command(cl, w, args)
+		// flush only when there are no more pipelined commands
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	rep, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := rep.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, errProtocol
+	}
+	args := make([][]byte, len(arr))
+	for i, a := range arr {
+		if args[i], ok = a.([]byte); !ok {
+			return nil, errProtocol
+		}
+	}
+	return args, nil
+}
+
+// command handle transaction related commands and execute all others.
+func (s *Server) command(cl *client, w *bufio.Writer, args [][]byte) {
+	name := strings.ToUpper(string(args[0]))
+
+	switch name {
+	case "MULTI":
+		if cl.multi {
+			writeError(w, "ERR MULTI calls can not be nested")
+			return
+		}
+		cl.multi = true
+		writeSimple(w, "OK")
+		return
+	case "DISCARD":
+		if !cl.multi {
+			writeError(w, "ERR DISCARD without MULTI")
+			return
+		}
+		cl.multi, cl.queued, cl.watched = false, nil, nil
+		writeSimple(w, "OK")
+		return
+	case "EXEC":
+		if !cl.multi {
+			writeError(w, "ERR EXEC without MULTI")
+			return
+		}
+		s.mu.Lock()
+		aborted := false
+		for key, ver := range cl.watched {
+			s.lookup(key)
+			if s.versions[key] != ver {
+				aborted = true
+			}
+		}
+		if aborted {
+			w.WriteString("*-1\r\n")
+		} else {
+			w.WriteString("*" + strconv.Itoa(len(cl.queued)) + "\r\n")
+			for _, cmd := range cl.queued {
+				s.exec(w, cmd)
+			}
+		}
+		s.mu.Unlock()
+		cl.multi, cl.queued, cl.watched = false, nil, nil
+		return
+	case "WATCH":
+		if cl.multi {
+			writeError(w, "ERR WATCH inside MULTI is not allowed")
+			return
+		}
+		if cl.watched == nil {
+			cl.watched = make(map[string]uint64)
+		}
+		s.mu.Lock()
+		for _, key := range args[1:] {
+			s.lookup(string(key))
+			cl.watched[string(key)] = s.versions[string(key)]
+		}
+		s.mu.Unlock()
+		writeSimple(w, "OK")
+		return
+	case "UNWATCH":
+		cl.watched = nil
+		writeSimple(w, "OK")
+		return
+	}
+
+	if cl.multi {
+		cl.queued = append(cl.queued, args)
+		writeSimple(w, "QUEUED")
+		return
+	}
+	s.mu.Lock()
+	s.exec(w, args)
+	s.mu.Unlock()
+}
+
+// lookup return not expired entry. Caller must hold the lock.
+func (s *Server) lookup(key string) (*entry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(s.data, key)
+		s.versions[key]++
+		return nil, false
+	}
+	return e, ok
+}
+
+// set store value. Caller must hold the lock.
+func (s *Server) set(key string, e *entry) {
+	s.data[key] = e
+	s.versions[key]++
+}
+
+// exec execute single command. Caller must hold the lock.
+func (s *Server) exec(w *bufio.Writer, args [][]byte) {
+	switch name := strings.ToUpper(string(args[0])); name {
+	case "PING":
+		writeSimple(w, "PONG")
+	case "GET":
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments for 'get' command")
+			return
+		}
+		if e, ok := s.lookup(string(args[1])); ok {
+			writeBulk(w, e.val)
+		} else {
+			writeNull(w)
+		}
+	case "MGET":
+		w.WriteString("*" + strconv.Itoa(len(args)-1) + "\r\n")
+		for _, key := range args[1:] {
+			if e, ok := s.lookup(string(key)); ok {
+				writeBulk(w, e.val)
+			} else {
+				writeNull(w)
+			}
+		}
+	case "SET":
+		s.execSet(w, args)
+	case "DEL":
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := s.lookup(string(key)); ok {
+				delete(s.data, string(key))
+				s.versions[string(key)]++
+				n++
+			}
+		}
+		writeInt(w, n)
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		s.execIncr(w, name, args)
+	case "FLUSHALL", "FLUSHDB":
+		for key := range s.data {
+			s.versions[key]++
+		}
+		s.data = make(map[string]*entry)
+		writeSimple(w, "OK")
+	default:
+		writeError(w, "ERR unknown command '"+string(args[0])+"'")
+	}
+}
+
+func (s *Server) execSet(w *bufio.Writer, args [][]byte) {
+	if len(args) < 3 {
+		writeError(w, "ERR wrong number of arguments for 'set' command")
+		return
+	}
+	key := string(args[1])
+	e := &entry{val: append([]byte(nil), args[2]...)}
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "PX", "EX":
+			if i+1 >= len(args) {
+				writeError(w, "ERR syntax error")
+				return
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Millisecond
+			if bytes.EqualFold(args[i], []byte("EX")) {
+				unit = time.Second
+			}
+			e.expires = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	_, exists := s.lookup(key)
+	if nx && exists || xx && !exists {
+		writeNull(w)
+		return
+	}
+	s.set(key, e)
+	writeSimple(w, "OK")
+}
+
+func (s *Server) execIncr(w *bufio.Writer, name string, args [][]byte) {
+	delta := int64(1)
+	switch name {
+	case "INCRBY", "DECRBY":
+		if len(args) != 3 {
+			writeError(w, "ERR wrong number of arguments")
+			return
+		}
+		var err error
+		if delta, err = strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+			writeError(w, "ERR value is not an integer or out of range")
+			return
+		}
+	default:
+		if len(args) != 2 {
+			writeError(w, "ERR wrong number of arguments")
+			return
+		}
+	}
+	if name == "DECR" || name == "DECRBY" {
+		delta = -delta
+	}
+
+	key := string(args[1])
+	var n int64
+	e, ok := s.lookup(key)
+	if ok {
+		var err error
+		if n, err = strconv.ParseInt(string(e.val), 10, 64); err != nil {
+			writeError(w, "ERR value is not an integer or out of range")
+			return
+		}
+	} else {
+		e = &entry{}
+	}
+	n += delta
+	// expiration time is preserved
+	s.set(key, &entry{val: strconv.AppendInt(nil, n, 10), expires: e.expires})
+	writeInt(w, n)
+}
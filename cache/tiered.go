@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Broadcaster delivers invalidation messages between cache instances,
+// usually running in different processes.
+type Broadcaster interface {
+	// Publish send message to all subscribers, including the sender.
+	Publish(msg string) error
+	// Subscribe return channel receiving all published messages, until
+	// context is done. Empty message is received when some messages might
+	// have been lost, for example because of reconnection.
+	Subscribe(ctx context.Context) (<-chan string, error)
+}
+
+// TieredOpts defines tiered cache settings.
+type TieredOpts struct {
+	// MaxSize is the maximum number of entries kept locally. Defaults to
+	// 1000.
+	MaxSize int
+	// LocalTTL is the maximum time entry is kept locally, limiting how long
+	// stale value can be returned. Defaults to 5 seconds.
+	LocalTTL time.Duration
+	// Broadcaster, if set, is used to notify other instances about modified
+	// entries, so that they can drop their local copies.
+	Broadcaster Broadcaster
+	// Codec is used to serialize local copies. Defaults to JSON.
+	Codec Codec
+}
+
+type tieredCache struct {
+	local  *localCache
+	remote Cache
+	ttl    time.Duration
+	bc     Broadcaster
+	// id identifies this instance in broadcasted messages
+	id string
+}
+
+// NewTieredCache return cache that keeps recently used entries in memory, in
+// front of given remote cache. Reads are served from memory if possible and
+// loaded from remote cache on miss. Writes go to the remote cache first.
+//
+// Local copies are kept for a short time only. If broadcaster is provided,
+// modified entries are additionally dropped by all instances using the same
+// broadcaster.
+//
+// Background processes run until given context is done.
+func NewTieredCache(ctx context.Context, remote Cache, o *TieredOpts) (Cache, error) {
+	if o == nil {
+		o = &TieredOpts{}
+	}
+	opts := *o
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 1000
+	}
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = 5 * time.Second
+	}
+
+	c := &tieredCache{
+		local:  newLocalCache(opts.MaxSize),
+		remote: remote,
+		ttl:    opts.LocalTTL,
+		bc:     opts.Broadcaster,
+		id:     instanceID(),
+	}
+	if opts.Codec != nil {
+		c.local.codec = opts.Codec
+	}
+	if c.bc != nil {
+		msgs, err := c.bc.Subscribe(ctx)
+		if err != nil {
+			return nil, err
+		}
+		go c.listen(msgs)
+	}
+	c.local.startJanitor(ctx)
+	return c, nil
+}
+
+func instanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// listen drop local copies of entries modified by other instances.
+func (c *tieredCache) listen(msgs <-chan string) {
+	for msg := range msgs {
+		if msg == "" {
+			// invalidations might have been lost
+			c.local.clear()
+			continue
+		}
+		// message format is "<instance id> <kind> <name>"
+		chunks := strings.SplitN(msg, " ", 3)
+		if len(chunks) != 3 {
+			log.Printf("invalid cache invalidation message: %q", msg)
+			continue
+		}
+		if chunks[0] == c.id {
+			continue
+		}
+		switch name := chunks[2]; chunks[1] {
+		case "k":
+			c.local.Del(name)
+		case "t":
+			// tags of copies loaded from remote cache are unknown
+			c.local.clear()
+		case "p":
+			c.local.DelPrefix(name)
+		default:
+			log.Printf("invalid cache invalidation message: %q", msg)
+		}
+	}
+}
+
+// invalidate notify other instances that entry was modified.
+func (c *tieredCache) invalidate(key string) {
+	c.publish("k", key)
+}
+
+func (c *tieredCache) publish(kind, name string) {
+	if c.bc == nil {
+		return
+	}
+	if err := c.bc.Publish(c.id + " " + kind + " " + name); err != nil {
+		log.Printf("cannot broadcast %q cache invalidation: %s", name, err)
+	}
+}
+
+// keep store local copy of the value.
+func (c *tieredCache) keep(key string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+	if err := c.local.PutTTL(key, value, ttl); err != nil {
+		log.Printf("cannot store %q locally: %s", key, err)
+	}
+}
+
+// WithContext return cache sharing local entries with c, that is calling the
+// remote cache within given context.
+func (c *tieredCache) WithContext(ctx context.Context) Cache {
+	cc := *c
+	cc.remote = bind(ctx, c.remote)
+	return &cc
+}
+
+// Stats return usage of the local cache.
+func (c *tieredCache) Stats() Stats {
+	return c.local.Stats()
+}
+
+// Codec return codec of the remote cache.
+func (c *tieredCache) Codec() Codec {
+	return codecOf(c.remote)
+}
+
+func (c *tieredCache) Get(key string, dest interface{}) error {
+	if err := c.local.Get(key, dest); err != ErrNotFound {
+		return err
+	}
+	if err := c.remote.Get(key, dest); err != nil {
+		return err
+	}
+	c.keep(key, dest, 0)
+	return nil
+}
+
+// GetVersion always read from the remote cache, because only remote version
+// can be used for CompareAndSwap.
+func (c *tieredCache) GetVersion(key string, dest interface{}) (uint64, error) {
+	version, err := c.remote.GetVersion(key, dest)
+	if err != nil {
+		if err == ErrNotFound {
+			c.local.Del(key)
+		}
+		return 0, err
+	}
+	c.keep(key, dest, 0)
+	return version, nil
+}
+
+func (c *tieredCache) Put(key string, src interface{}) error {
+	return c.PutTTL(key, src, 0)
+}
+
+func (c *tieredCache) PutTTL(key string, src interface{}, ttl time.Duration) error {
+	return c.write(key, src, ttl, func() error {
+		return c.remote.PutTTL(key, src, ttl)
+	})
+}
+
+func (c *tieredCache) PutTagged(key string, src interface{}, ttl time.Duration, tags ...string) error {
+	if err := c.remote.PutTagged(key, src, ttl, tags...); err != nil {
+		c.local.Del(key)
+		return err
+	}
+	c.keep(key, src, ttl)
+	c.invalidate(key)
+	return nil
+}
+
+func (c *tieredCache) Add(key string, src interface{}, ttl time.Duration) error {
+	return c.write(key, src, ttl, func() error {
+		return c.remote.Add(key, src, ttl)
+	})
+}
+
+func (c *tieredCache) Replace(key string, src interface{}, ttl time.Duration) error {
+	return c.write(key, src, ttl, func() error {
+		return c.remote.Replace(key, src, ttl)
+	})
+}
+
+func (c *tieredCache) CompareAndSwap(key string, src interface{}, version uint64, ttl time.Duration) error {
+	return c.write(key, src, ttl, func() error {
+		return c.remote.CompareAndSwap(key, src, version, ttl)
+	})
+}
+
+// write store value in the remote cache using given function. On success
+// local copy is updated, otherwise it is dropped, because it might be stale.
+func (c *tieredCache) write(key string, src interface{}, ttl time.Duration, store func() error) error {
+	if err := store(); err != nil {
+		c.local.Del(key)
+		return err
+	}
+	c.keep(key, src, ttl)
+	c.invalidate(key)
+	return nil
+}
+
+func (c *tieredCache) Incr(key string, delta int64) (int64, error) {
+	n, err := c.remote.Incr(key, delta)
+	c.local.Del(key)
+	if err == nil {
+		c.invalidate(key)
+	}
+	return n, err
+}
+
+func (c *tieredCache) Decr(key string, delta int64) (int64, error) {
+	n, err := c.remote.Decr(key, delta)
+	c.local.Del(key)
+	if err == nil {
+		c.invalidate(key)
+	}
+	return n, err
+}
+
+func (c *tieredCache) Del(key string) error {
+	err := c.remote.Del(key)
+	c.local.Del(key)
+	if err == nil {
+		c.invalidate(key)
+	}
+	return err
+}
+
+// InvalidateTag remove tagged values. Local copies of values that were loaded
+// from the remote cache do not carry tags, so all local copies are dropped.
+func (c *tieredCache) InvalidateTag(tag string) error {
+	err := c.remote.InvalidateTag(tag)
+	c.local.clear()
+	if err == nil {
+		c.publish("t", tag)
+	}
+	return err
+}
+
+func (c *tieredCache) DelPrefix(prefix string) error {
+	err := c.remote.DelPrefix(prefix)
+	c.local.DelPrefix(prefix)
+	if err == nil {
+		c.publish("p", prefix)
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestTieredCache(t *testing.T) {
+	ctx, done := context.WithCancel(context.Background())
+	defer done()
+
+	now := time.Now()
+	remote := newLocalCache(100)
+	tc, err := NewTieredCache(ctx, remote, &TieredOpts{LocalTTL: time.Second})
+	if err != nil {
+		t.Fatalf("cannot create cache: %s", err)
+	}
+	c := tc.(*tieredCache)
+	c.local.now = func() time.Time { return now }
+
+	// read through
+	must(remote.Put("a", 1))
+	var val int
+	must(c.Get("a", &val))
+	if val != 1 {
+		t.Fatalf("want 1, got %d", val)
+	}
+
+	// local copy is used until it expires
+	must(remote.Put("a", 2))
+	must(c.Get("a", &val))
+	if val != 1 {
+		t.Fatalf("want stale 1, got %d", val)
+	}
+	now = now.Add(time.Second)
+	must(c.Get("a", &val))
+	if val != 2 {
+		t.Fatalf("want 2, got %d", val)
+	}
+
+	// write through
+	must(c.Put("b", 3))
+	must(remote.Get("b", &val))
+	if val != 3 {
+		t.Fatalf("want 3, got %d", val)
+	}
+
+	must(c.Del("b"))
+	if err := remote.Get("b", &val); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if err := c.Get("b", &val); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+
+	// failed write drops local copy
+	version, err := c.GetVersion("a", &val)
+	if err != nil {
+		t.Fatalf("cannot get version: %s", err)
+	}
+	must(remote.Put("a", 4))
+	if err := c.CompareAndSwap("a", 5, version, 0); err != ErrConflict {
+		t.Fatalf("want ErrConflict, got %v", err)
+	}
+	must(c.Get("a", &val))
+	if val != 4 {
+		t.Fatalf("want 4, got %d", val)
+	}
+
+	if n, err := c.Incr("a", 2); err != nil || n != 6 {
+		t.Fatalf("want 6, got %d, %v", n, err)
+	}
+	must(c.Get("a", &val))
+	if val != 6 {
+		t.Fatalf("want 6, got %d", val)
+	}
+}
+
+func TestTieredCacheBroadcast(t *testing.T) {
+	ctx, done := context.WithCancel(context.Background())
+	defer done()
+
+	remote := newLocalCache(100)
+	bc := &memBroadcaster{}
+	a, err := NewTieredCache(ctx, remote, &TieredOpts{LocalTTL: time.Hour, Broadcaster: bc})
+	if err != nil {
+		t.Fatalf("cannot create cache: %s", err)
+	}
+	b, err := NewTieredCache(ctx, remote, &TieredOpts{LocalTTL: time.Hour, Broadcaster: bc})
+	if err != nil {
+		t.Fatalf("cannot create cache: %s", err)
+	}
+
+	must(a.Put("x", 1))
+	var val int
+	must(b.Get("x", &val))
+
+	must(a.Put("x", 2))
+	waitFor(t, func() bool {
+		must(b.Get("x", &val))
+		return val == 2
+	})
+
+	// when messages are lost, all local copies are dropped
+	must(remote.Put("x", 3))
+	bc.Publish("")
+	for _, c := range []Cache{a, b} {
+		waitFor(t, func() bool {
+			must(c.Get("x", &val))
+			return val == 3
+		})
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+// memBroadcaster delivers messages to all subscribers within the process.
+type memBroadcaster struct {
+	mu   sync.Mutex
+	subs []chan string
+}
+
+func (b *memBroadcaster) Publish(msg string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		sub <- msg
+	}
+	return nil
+}
+
+func (b *memBroadcaster) Subscribe(ctx context.Context) (<-chan string, error) {
+	sub := make(chan string, 100)
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+	return sub, nil
+}
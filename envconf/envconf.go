@@ -7,7 +7,6 @@ import (
 	"os"
 	"reflect"
 	"regexp"
-	"strconv"
 	"strings"
 	"sync"
 )
@@ -62,33 +61,12 @@ func Load(dest interface{}, settings map[string]string) error {
 			continue
 		}
 
-		switch f.Kind() {
-		case reflect.String:
-			f.SetString(value)
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			var intValue int64
-			var err error
-			if value != "" {
-				intValue, err = strconv.ParseInt(value, 0, f.Type().Bits())
-			}
-			if err != nil {
-				errs = append(errs, &ParseError{
-					Field: tp.Field(i).Name,
-					Name:  name,
-					Value: value,
-					Err:   err,
-					Kind:  f.Kind(),
-				})
-				continue
-			}
-			f.SetInt(intValue)
-		case reflect.Bool:
-			var boolValue bool
-			var err error
-			if value != "" {
-				boolValue, err = strconv.ParseBool(value)
-			}
-			if err != nil {
+		if f.Kind() != reflect.Slice {
+			if err := SetValue(f, value); err != nil {
+				if err == ErrUnsupported {
+					log.Printf("unsupported type: %s", f.Kind())
+					continue
+				}
 				errs = append(errs, &ParseError{
 					Field: tp.Field(i).Name,
 					Name:  name,
@@ -96,93 +74,31 @@ func Load(dest interface{}, settings map[string]string) error {
 					Err:   err,
 					Kind:  f.Kind(),
 				})
-				continue
-			}
-			f.SetBool(boolValue)
-		case reflect.Float32, reflect.Float64:
-			var floatValue float64
-			var err error
-			if value != "" {
-				floatValue, err = strconv.ParseFloat(value, f.Type().Bits())
 			}
-			if err != nil {
+			continue
+		}
+
+		if value == "" {
+			continue
+		}
+		for _, v := range splitList(value) {
+			el := reflect.New(f.Type().Elem()).Elem()
+			if err := SetValue(el, v); err != nil {
+				if err == ErrUnsupported {
+					log.Printf("unsupported type: %s", el.Kind())
+					break
+				}
 				errs = append(errs, &ParseError{
 					Field: tp.Field(i).Name,
 					Name:  name,
-					Value: value,
+					Value: v,
 					Err:   err,
 					Kind:  f.Kind(),
 				})
 				continue
 			}
-			f.SetFloat(floatValue)
-		case reflect.Slice:
-			if value == "" {
-				continue
-			}
-			vals := splitList(value)
-
-			switch f.Type().Elem().Kind() {
-			case reflect.String:
-				for _, v := range vals {
-					f.Set(reflect.Append(f, reflect.ValueOf(v)))
-				}
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				for _, v := range vals {
-					intValue, err := strconv.ParseInt(v, 0, f.Type().Elem().Bits())
-					if err != nil {
-						errs = append(errs, &ParseError{
-							Field: tp.Field(i).Name,
-							Name:  name,
-							Value: v,
-							Err:   err,
-							Kind:  f.Kind(),
-						})
-						continue
-					}
-					iv := reflect.New(f.Type().Elem()).Elem()
-					iv.SetInt(intValue)
-					f.Set(reflect.Append(f, iv))
-				}
-			case reflect.Bool:
-				for _, v := range vals {
-					boolValue, err := strconv.ParseBool(v)
-					if err != nil {
-						errs = append(errs, &ParseError{
-							Field: tp.Field(i).Name,
-							Name:  name,
-							Value: v,
-							Err:   err,
-							Kind:  f.Kind(),
-						})
-						continue
-					}
-					f.Set(reflect.Append(f, reflect.ValueOf(boolValue)))
-				}
-			case reflect.Float32, reflect.Float64:
-				for _, v := range vals {
-					floatValue, err := strconv.ParseFloat(v, f.Type().Elem().Bits())
-					if err != nil {
-						errs = append(errs, &ParseError{
-							Field: tp.Field(i).Name,
-							Name:  name,
-							Value: v,
-							Err:   err,
-							Kind:  f.Kind(),
-						})
-						continue
-					}
-					fv := reflect.New(f.Type().Elem()).Elem()
-					fv.SetFloat(floatValue)
-					f.Set(reflect.Append(f, fv))
-				}
-			default:
-				log.Printf("unsupported type: %s", f.Kind())
-			}
-		default:
-			log.Printf("unsupported type: %s", f.Kind())
+			f.Set(reflect.Append(f, el))
 		}
-
 	}
 
 	if len(errs) == 0 {
@@ -269,13 +185,19 @@ func contains(arr []string, s string) bool {
 }
 
 func convertName(s string) string {
+	return strings.ToUpper(Underscore(s))
+}
+
+// Underscore return given camel case name with words separated by
+// underscore. Case of the letters is not changed, for example "HTTPPort"
+// becomes "HTTP_Port".
+func Underscore(s string) string {
 	s = conv1.ReplaceAllStringFunc(s, func(val string) string {
 		return val[:1] + "_" + val[1:]
 	})
-	s = conv2.ReplaceAllStringFunc(s, func(val string) string {
+	return conv2.ReplaceAllStringFunc(s, func(val string) string {
 		return val[:1] + "_" + val[1:]
 	})
-	return strings.ToUpper(s)
 }
 
 var (
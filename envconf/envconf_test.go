@@ -1,8 +1,11 @@
 package envconf
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadInvalidDest(t *testing.T) {
@@ -271,3 +274,122 @@ func TestConvertName(t *testing.T) {
 		}
 	}
 }
+
+func TestUnderscore(t *testing.T) {
+	var testCases = []struct {
+		input string
+		want  string
+	}{
+		{"FooBar", "Foo_Bar"},
+		{"HTTPPort", "HTTP_Port"},
+		{"userID", "user_ID"},
+	}
+	for i, tc := range testCases {
+		got := Underscore(tc.input)
+		if got != tc.want {
+			t.Errorf("%d: want %q, got %q", i, tc.want, got)
+		}
+	}
+}
+
+func TestLoadTime(t *testing.T) {
+	var c struct {
+		Timeout  time.Duration
+		Since    time.Time
+		Day      time.Time
+		Retries  []time.Duration
+		Disabled time.Duration
+	}
+	in := map[string]string{
+		"TIMEOUT":  "1m30s",
+		"SINCE":    "2016-01-02T15:04:05Z",
+		"DAY":      "2016-01-02",
+		"RETRIES":  "1s;2s",
+		"DISABLED": "",
+	}
+	if err := Load(&c, in); err != nil {
+		t.Fatalf("cannot load configuration: %s", err)
+	}
+	if c.Timeout != 90*time.Second {
+		t.Errorf("invalid Timeout value: %s", c.Timeout)
+	}
+	if want := time.Date(2016, 1, 2, 15, 4, 5, 0, time.UTC); !c.Since.Equal(want) {
+		t.Errorf("invalid Since value: %s", c.Since)
+	}
+	if want := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC); !c.Day.Equal(want) {
+		t.Errorf("invalid Day value: %s", c.Day)
+	}
+	if !reflect.DeepEqual(c.Retries, []time.Duration{time.Second, 2 * time.Second}) {
+		t.Errorf("invalid Retries value: %v", c.Retries)
+	}
+	if c.Disabled != 0 {
+		t.Errorf("invalid Disabled value: %s", c.Disabled)
+	}
+}
+
+func TestLoadInvalidValue(t *testing.T) {
+	var c struct {
+		A int
+		B []int
+		C time.Duration
+	}
+	in := map[string]string{
+		"A": "x",
+		"B": "1;y",
+		"C": "10",
+	}
+	err := Load(&c, in)
+	errs, ok := err.(ParseErrors)
+	if !ok {
+		t.Fatalf("want ParseErrors, got %#v", err)
+	}
+	if len(errs) != 3 {
+		t.Errorf("want 3 errors, got %d: %v", len(errs), errs)
+	}
+	if !reflect.DeepEqual(c.B, []int{1}) {
+		t.Errorf("invalid B value: %v", c.B)
+	}
+}
+
+type color int
+
+func (c *color) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "red":
+		*c = 1
+	case "green":
+		*c = 2
+	default:
+		return fmt.Errorf("unknown color %q", b)
+	}
+	return nil
+}
+
+func TestLoadTextUnmarshaler(t *testing.T) {
+	var c struct {
+		Color   color
+		Palette []color
+		Invalid color
+		Empty   color
+	}
+	c.Empty = 1
+	in := map[string]string{
+		"COLOR":   "Green",
+		"PALETTE": "red;green",
+		"INVALID": "blue",
+		"EMPTY":   "",
+	}
+	err := Load(&c, in)
+	if errs, ok := err.(ParseErrors); !ok || len(errs) != 1 || errs[0].Field != "Invalid" {
+		t.Fatalf("want Invalid field error, got %#v", err)
+	}
+	if c.Color != 2 {
+		t.Errorf("invalid Color value: %d", c.Color)
+	}
+	if !reflect.DeepEqual(c.Palette, []color{1, 2}) {
+		t.Errorf("invalid Palette value: %v", c.Palette)
+	}
+	if c.Empty != 0 {
+		t.Errorf("invalid Empty value: %d", c.Empty)
+	}
+}
@@ -0,0 +1,106 @@
+package envconf
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// ErrUnsupported is returned by SetValue when destination type cannot be
+// assigned from text.
+var ErrUnsupported = errors.New("unsupported type")
+
+// SetValue parse given text representation and assign it to destination
+// value. Empty string always results in zero value being set.
+//
+// Supported are string, integer, unsigned integer, boolean, floating point,
+// time.Duration and time.Time (RFC 3339 or YYYY-MM-DD format) types. Any
+// other addressable type implementing encoding.TextUnmarshaler is supported
+// as well.
+func SetValue(v reflect.Value, raw string) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok && v.Type() != timeType {
+			if raw == "" {
+				v.Set(reflect.Zero(v.Type()))
+				return nil
+			}
+			return u.UnmarshalText([]byte(raw))
+		}
+	}
+
+	switch v.Type() {
+	case durationType:
+		var d time.Duration
+		if raw != "" {
+			var err error
+			if d, err = time.ParseDuration(raw); err != nil {
+				return err
+			}
+		}
+		v.SetInt(int64(d))
+		return nil
+	case timeType:
+		var t time.Time
+		if raw != "" {
+			var err error
+			if t, err = time.Parse(time.RFC3339, raw); err != nil {
+				if t, err = time.Parse("2006-01-02", raw); err != nil {
+					return err
+				}
+			}
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if raw != "" {
+			var err error
+			if n, err = strconv.ParseInt(raw, 0, v.Type().Bits()); err != nil {
+				return err
+			}
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if raw != "" {
+			var err error
+			if n, err = strconv.ParseUint(raw, 0, v.Type().Bits()); err != nil {
+				return err
+			}
+		}
+		v.SetUint(n)
+	case reflect.Bool:
+		var b bool
+		if raw != "" {
+			var err error
+			if b, err = strconv.ParseBool(raw); err != nil {
+				return err
+			}
+		}
+		v.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if raw != "" {
+			var err error
+			if f, err = strconv.ParseFloat(raw, v.Type().Bits()); err != nil {
+				return err
+			}
+		}
+		v.SetFloat(f)
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
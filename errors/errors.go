@@ -0,0 +1,271 @@
+// Package errors implements error values carrying the stack trace of the
+// place they were created at, key-value context and a kind, that describes
+// the class of the failure.
+//
+// Errors are created with New or by wrapping existing error with Wrap. Kind,
+// context and stack trace are inherited by the wrapping error and can be
+// retrieved using KindOf, FieldsOf and StackOf. The log package writes them
+// together with the error message.
+//
+// Sentinel return errors that can be compared with ==, which is useful for
+// package level error values.
+package errors
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Kind describes the class of the failure.
+type Kind uint8
+
+const (
+	// Other is the kind of errors that are not classified.
+	Other Kind = iota
+	// NotFound is the kind of errors caused by missing entity.
+	NotFound
+	// Conflict is the kind of errors caused by entity state not allowing
+	// operation, for example because of a duplicated unique value.
+	Conflict
+	// Invalid is the kind of errors caused by invalid input.
+	Invalid
+	// Unauthorized is the kind of errors caused by missing or invalid
+	// credentials.
+	Unauthorized
+)
+
+var kindNames = [...]string{
+	Other:        "other",
+	NotFound:     "not found",
+	Conflict:     "conflict",
+	Invalid:      "invalid",
+	Unauthorized: "unauthorized",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Error is error with kind, key-value context and stack trace.
+type Error struct {
+	kind    Kind
+	msg     string
+	cause   error
+	keyvals []interface{}
+	stack   []uintptr
+}
+
+// maxStackDepth is the maximum number of frames captured.
+const maxStackDepth = 32
+
+// New return error of given kind and message. Key-value pairs are the
+// context of the error. Stack trace of the caller is captured.
+func New(kind Kind, msg string, keyvals ...interface{}) error {
+	return &Error{kind: kind, msg: msg, keyvals: keyvals, stack: callers()}
+}
+
+// Errorf return error of given kind with formatted message. Stack trace of
+// the caller is captured.
+func Errorf(kind Kind, format string, args ...interface{}) error {
+	return &Error{kind: kind, msg: fmt.Sprintf(format, args...), stack: callers()}
+}
+
+// Wrap return error wrapping given one, with message prefixed with msg, if not
+// empty. Key-value pairs are added to the context of the error. Kind is
+// inherited from the wrapped error. Stack trace of the caller is captured
+// only if wrapped error does not carry one already.
+//
+// Wrap return nil if err is nil.
+func Wrap(err error, msg string, keyvals ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{kind: KindOf(err), msg: msg, cause: err, keyvals: keyvals}
+	if StackOf(err) == nil {
+		e.stack = callers()
+	}
+	return e
+}
+
+// WithKind return error wrapping given one, that is of given kind. Stack
+// trace of the caller is captured only if wrapped error does not carry one
+// already.
+//
+// WithKind return nil if err is nil.
+func WithKind(err error, kind Kind) error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{kind: kind, cause: err}
+	if StackOf(err) == nil {
+		e.stack = callers()
+	}
+	return e
+}
+
+// Sentinel return error of given kind and message without stack trace. Use
+// it to declare package level errors that are compared by identity.
+func Sentinel(kind Kind, msg string) error {
+	return &Error{kind: kind, msg: msg}
+}
+
+func callers() []uintptr {
+	var pcs [maxStackDepth]uintptr
+	// skip runtime.Callers, callers and the constructor
+	n := runtime.Callers(3, pcs[:])
+	stack := make([]uintptr, n)
+	copy(stack, pcs[:n])
+	return stack
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.cause == nil:
+		return e.msg
+	case e.msg == "":
+		return e.cause.Error()
+	default:
+		return e.msg + ": " + e.cause.Error()
+	}
+}
+
+// Kind return kind of the error.
+func (e *Error) Kind() Kind {
+	return e.kind
+}
+
+// Cause return wrapped error or nil.
+func (e *Error) Cause() error {
+	return e.cause
+}
+
+// Fields return key-value context of the error, without the context of the
+// wrapped errors.
+func (e *Error) Fields() []interface{} {
+	return e.keyvals
+}
+
+// Stack return program counters of the stack trace captured when error was
+// created, or nil.
+func (e *Error) Stack() []uintptr {
+	return e.stack
+}
+
+// KindOf return kind of given error. Kind is taken from the first error in
+// the chain of wrapped errors that has one. Errors that do not carry kind
+// are of kind Other.
+func KindOf(err error) Kind {
+	for err != nil {
+		if k, ok := err.(interface {
+			Kind() Kind
+		}); ok {
+			return k.Kind()
+		}
+		err = unwrap(err)
+	}
+	return Other
+}
+
+// Is return true if given error or any error it is wrapping is equal to
+// target.
+func Is(err, target error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		err = unwrap(err)
+	}
+	return false
+}
+
+// Cause return the innermost error wrapped by given error.
+func Cause(err error) error {
+	for {
+		c := unwrap(err)
+		if c == nil {
+			return err
+		}
+		err = c
+	}
+}
+
+func unwrap(err error) error {
+	if c, ok := err.(interface {
+		Cause() error
+	}); ok {
+		return c.Cause()
+	}
+	return nil
+}
+
+// FieldsOf return key-value context of given error and all errors it is
+// wrapping. Context of the outer error comes first.
+func FieldsOf(err error) []interface{} {
+	var keyvals []interface{}
+	for err != nil {
+		if f, ok := err.(interface {
+			Fields() []interface{}
+		}); ok {
+			keyvals = append(keyvals, f.Fields()...)
+		}
+		err = unwrap(err)
+	}
+	return keyvals
+}
+
+// StackOf return the innermost stack trace carried by given error or nil.
+func StackOf(err error) []uintptr {
+	var stack []uintptr
+	for err != nil {
+		if s, ok := err.(interface {
+			Stack() []uintptr
+		}); ok && s.Stack() != nil {
+			stack = s.Stack()
+		}
+		err = unwrap(err)
+	}
+	return stack
+}
+
+// Frame describes single function call of the stack trace.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+func (f Frame) String() string {
+	return f.Function + " " + f.File + ":" + strconv.Itoa(f.Line)
+}
+
+// Frames return frames of given stack trace.
+func Frames(stack []uintptr) []Frame {
+	if len(stack) == 0 {
+		return nil
+	}
+	frames := make([]Frame, 0, len(stack))
+	it := runtime.CallersFrames(stack)
+	for {
+		fr, more := it.Next()
+		frames = append(frames, Frame{Function: fr.Function, File: fr.File, Line: fr.Line})
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// FormatStack return stack trace formatted as text, one frame per line.
+func FormatStack(stack []uintptr) string {
+	frames := Frames(stack)
+	lines := make([]string, len(frames))
+	for i, f := range frames {
+		lines[i] = f.String()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,71 @@
+package errors
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	base := New(NotFound, "no user", "user", 42)
+	err := Wrap(base, "cannot load profile", "profile", "main")
+
+	if got, want := err.Error(), "cannot load profile: no user"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if k := KindOf(err); k != NotFound {
+		t.Errorf("want NotFound, got %s", k)
+	}
+	if !Is(err, base) || Cause(err) != base {
+		t.Error("want base error wrapped")
+	}
+	if got, want := fmt.Sprint(FieldsOf(err)), "[profile main user 42]"; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	// stack trace is captured only once, where the error was created
+	if got, want := StackOf(err), base.(*Error).Stack(); len(got) == 0 || &got[0] != &want[0] {
+		t.Error("want stack of the wrapped error")
+	}
+	frames := Frames(StackOf(err))
+	if len(frames) == 0 || !strings.HasSuffix(frames[0].Function, ".TestWrap") {
+		t.Errorf("want TestWrap frame first, got %v", frames)
+	}
+	if !strings.HasPrefix(FormatStack(StackOf(err)), frames[0].String()) {
+		t.Error("invalid stack format")
+	}
+
+	if Wrap(nil, "ignored") != nil || WithKind(nil, Invalid) != nil {
+		t.Error("want nil")
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	plain := fmt.Errorf("failed")
+	cases := []struct {
+		err  error
+		want Kind
+	}{
+		{nil, Other},
+		{plain, Other},
+		{Wrap(plain, "wrapped"), Other},
+		{WithKind(plain, Invalid), Invalid},
+		{Wrap(WithKind(plain, Unauthorized), ""), Unauthorized},
+		{WithKind(New(NotFound, "missing"), Conflict), Conflict},
+		{Sentinel(Conflict, "conflict"), Conflict},
+	}
+	for i, tc := range cases {
+		if got := KindOf(tc.err); got != tc.want {
+			t.Errorf("%d: want %s, got %s", i, tc.want, got)
+		}
+	}
+
+	if StackOf(WithKind(plain, Invalid)) == nil {
+		t.Error("want stack captured")
+	}
+	if StackOf(Sentinel(NotFound, "not found")) != nil {
+		t.Error("want no stack for sentinel")
+	}
+	if s := Kind(42).String(); s != "kind(42)" {
+		t.Errorf("unexpected kind name: %s", s)
+	}
+}
@@ -0,0 +1,41 @@
+// Package testutil provides helpers shared by tests of the testing helper
+// packages.
+package testutil
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// RecordingT is testing.TB that is recording reported errors instead of
+// failing the test. All other calls are passed to the embedded TB.
+type RecordingT struct {
+	testing.TB
+
+	mu     sync.Mutex
+	errors []string
+}
+
+func (t *RecordingT) Error(args ...interface{}) {
+	t.record(fmt.Sprint(args...))
+}
+
+func (t *RecordingT) Errorf(format string, args ...interface{}) {
+	t.record(fmt.Sprintf(format, args...))
+}
+
+func (t *RecordingT) record(msg string) {
+	t.mu.Lock()
+	t.errors = append(t.errors, msg)
+	t.mu.Unlock()
+}
+
+// Errors return all recorded errors.
+func (t *RecordingT) Errors() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	errors := make([]string, len(t.errors))
+	copy(errors, t.errors)
+	return errors
+}
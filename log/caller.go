@@ -0,0 +1,140 @@
+package log
+
+import (
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// caller describes location of the log call.
+type caller struct {
+	// file is the "<package import path>/<file name>:<line>" location
+	file string
+	// function is the function name qualified with the package name
+	function string
+	// fullName is the function name qualified with the package import path
+	fullName string
+	// pkg is the import path of the package
+	pkg string
+}
+
+var unknownCaller = &caller{file: "???:0"}
+
+// callers cache locations of log calls by their program counter.
+var callers = struct {
+	sync.RWMutex
+	m map[uintptr]*caller
+}{m: make(map[uintptr]*caller)}
+
+// callerOf return location of the log call with given program counter, as
+// returned by runtime.Callers.
+func callerOf(pc uintptr) *caller {
+	callers.RLock()
+	c, ok := callers.m[pc]
+	callers.RUnlock()
+	if ok {
+		return c
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.File == "" {
+		return unknownCaller
+	}
+	pkg := funcPackage(frame.Function)
+	c = &caller{
+		file:     sourcePath(pkg, frame.File) + ":" + strconv.Itoa(frame.Line),
+		function: path.Base(frame.Function),
+		fullName: frame.Function,
+		pkg:      pkg,
+	}
+	callers.Lock()
+	callers.m[pc] = c
+	callers.Unlock()
+	return c
+}
+
+// sourcePath return path of the file relative to the source root, that is
+// the import path of its package followed by the file name. Files of the
+// main package are identified by their directory name instead.
+func sourcePath(pkg, file string) string {
+	dir, name := path.Split(file)
+	pkg = strings.TrimSuffix(pkg, "_test")
+	if pkg == "main" || pkg == "" {
+		return path.Join(path.Base(dir), name)
+	}
+	return pkg + "/" + name
+}
+
+// helpers is the set of functions marked by Helper, by their fully
+// qualified name.
+var helpers = struct {
+	sync.RWMutex
+	m map[string]struct{}
+	// n is the number of helpers, accessed atomically
+	n int32
+}{m: make(map[string]struct{})}
+
+// Helper marks the calling function as a logging helper. When the location
+// of the log call is resolved, helper functions are skipped, so that the
+// location of the code calling the helper is written instead. Helper can be
+// called many times, only the first call is registering the function.
+func Helper() {
+	var pcs [1]uintptr
+	if runtime.Callers(2, pcs[:]) != 1 {
+		return
+	}
+	c := callerOf(pcs[0])
+	if isHelper(c) || c == unknownCaller {
+		return
+	}
+	helpers.Lock()
+	if _, ok := helpers.m[c.fullName]; !ok {
+		helpers.m[c.fullName] = struct{}{}
+		atomic.AddInt32(&helpers.n, 1)
+	}
+	helpers.Unlock()
+}
+
+// isHelper return true if the function of given location was marked by
+// Helper.
+func isHelper(c *caller) bool {
+	if atomic.LoadInt32(&helpers.n) == 0 {
+		return false
+	}
+	helpers.RLock()
+	_, ok := helpers.m[c.fullName]
+	helpers.RUnlock()
+	return ok
+}
+
+// maxStackDepth is the maximum number of frames written in the stack trace.
+const maxStackDepth = 32
+
+// callStack return location of the log call and, if withStack is true,
+// program counters of its stack trace. Skip is the number of stack frames to
+// skip, with 0 identifying the caller of callStack. Helper functions are
+// skipped as well.
+func callStack(skip int, withStack bool) (*caller, []uintptr) {
+	var pcs [maxStackDepth]uintptr
+	n := 1
+	if withStack || atomic.LoadInt32(&helpers.n) != 0 {
+		n = len(pcs)
+	}
+	n = runtime.Callers(skip+2, pcs[:n])
+	for i := 0; i < n; i++ {
+		c := callerOf(pcs[i])
+		if isHelper(c) {
+			continue
+		}
+		if !withStack {
+			return c, nil
+		}
+		stack := make([]uintptr, n-i)
+		copy(stack, pcs[i:n])
+		return c, stack
+	}
+	return unknownCaller, nil
+}
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func logHelper(l *Logger, msg string) {
+	Helper()
+	l.Info(msg)
+}
+
+func logNestedHelper(l *Logger, msg string) {
+	Helper()
+	logHelper(l, msg)
+}
+
+func logWrapper(l *Logger, msg string) {
+	l.Info(msg)
+}
+
+func TestCallerLocation(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, nil)
+
+	logHelper(l, "helper")
+	logNestedHelper(l, "nested")
+	logWrapper(l.WithCallerSkip(1), "skip")
+	func() {
+		l.Info("closure")
+	}()
+
+	want := []string{
+		"github.com/husio/x/log/caller_test.go:29 log.TestCallerLocation",
+		"github.com/husio/x/log/caller_test.go:30 log.TestCallerLocation",
+		"github.com/husio/x/log/caller_test.go:31 log.TestCallerLocation",
+		"github.com/husio/x/log/caller_test.go:33 log.TestCallerLocation.func1",
+	}
+	dec := json.NewDecoder(&buf)
+	for i, w := range want {
+		var e map[string]string
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("%d: cannot decode: %s", i, err)
+		}
+		if got := e["file"] + " " + e["func"]; got != w {
+			t.Errorf("%d: want %q, got %q", i, w, got)
+		}
+		if _, ok := e["stack"]; ok {
+			t.Errorf("%d: unexpected stack", i)
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, &Opts{Encoder: &Console{}})
+	logWrapper(l, "no stack")
+	if strings.Contains(buf.String(), "\n\t") {
+		t.Errorf("unexpected stack: %s", buf.String())
+	}
+
+	buf.Reset()
+	l.Error("failed", "stack", "ignored")
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) < 3 || !strings.HasPrefix(lines[1], "\tgithub.com/husio/x/log.TestErrorStack ") {
+		t.Fatalf("want stack trace, got %q", buf.String())
+	}
+	if strings.Contains(lines[0], "ignored") {
+		t.Errorf("reserved key written: %q", lines[0])
+	}
+}
+
+func TestFatalFlush(t *testing.T) {
+	code := -1
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+
+	sink := &memSink{}
+	l := New(nil, &Opts{Sinks: []Sink{sink}})
+	l.Fatal("fatal")
+	if code != 1 {
+		t.Errorf("want exit code 1, got %d", code)
+	}
+	if sink.messages() != "fatal" || sink.flushed != 1 {
+		t.Errorf("want message flushed, got %q, %d flushes", sink.messages(), sink.flushed)
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	cases := []struct {
+		pkg, file, want string
+	}{
+		{"github.com/husio/x/log", "/src/github.com/husio/x/log/log.go", "github.com/husio/x/log/log.go"},
+		{"github.com/husio/x/log_test", "/src/github.com/husio/x/log/example_test.go", "github.com/husio/x/log/example_test.go"},
+		{"main", "/home/bob/app/cmd/server/main.go", "server/main.go"},
+	}
+	for _, tc := range cases {
+		if got := sourcePath(tc.pkg, tc.file); got != tc.want {
+			t.Errorf("%s: want %q, got %q", tc.file, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// Console encoder writes human readable, aligned entries, meant for local
+// development. Stack trace is written below the entry, one frame per line.
+type Console struct {
+	// Color enables coloring output using ANSI escape codes.
+	Color bool
+}
+
+// NewConsole return console encoder for given writer. Output is colored only
+// if writer is a terminal and NO_COLOR environment variable is not set.
+func NewConsole(w io.Writer) *Console {
+	return &Console{
+		Color: IsTerminal(w) && os.Getenv("NO_COLOR") == "",
+	}
+}
+
+// IsTerminal return true if given writer is a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorBrown = "\x1b[33m"
+	colorCyan  = "\x1b[36m"
+	colorGray  = "\x1b[90m"
+)
+
+// consoleMsgWidth is the width messages are padded to, so that the context of
+// consecutive entries is aligned.
+const consoleMsgWidth = 40
+
+func (c *Console) Encode(b []byte, e *Entry) []byte {
+	b = c.colored(b, colorGray, func(b []byte) []byte {
+		return e.Time.AppendFormat(b, "15:04:05.000")
+	})
+	b = append(b, ' ')
+
+	level := e.Level.String()
+	b = c.colored(b, levelColor(e.Level), func(b []byte) []byte {
+		return append(b, level...)
+	})
+	b = pad(b, len(level), 6)
+
+	b = append(b, e.Message...)
+	if len(e.Fields) > 0 {
+		b = pad(b, utf8.RuneCountInString(e.Message), consoleMsgWidth)
+	}
+	for _, f := range e.Fields {
+		b = append(b, ' ')
+		b = c.colored(b, colorCyan, func(b []byte) []byte {
+			b = appendLogfmtKey(b, f.Key)
+			return append(b, '=')
+		})
+		b = appendLogfmtValue(b, f)
+	}
+	b = append(b, "  "...)
+	b = c.colored(b, colorGray, func(b []byte) []byte {
+		b = append(b, e.File...)
+		if e.Function != "" {
+			b = append(b, ' ')
+			b = append(b, e.Function...)
+		}
+		return b
+	})
+	b = append(b, '\n')
+	if e.Stack != "" {
+		b = c.colored(b, colorGray, func(b []byte) []byte {
+			return appendIndented(b, e.Stack)
+		})
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// colored append content written by fn, wrapped in the color escape codes
+// if coloring is enabled.
+func (c *Console) colored(b []byte, color string, fn func([]byte) []byte) []byte {
+	if !c.Color {
+		return fn(b)
+	}
+	b = append(b, color...)
+	b = fn(b)
+	return append(b, colorReset...)
+}
+
+func levelColor(l Level) string {
+	switch l {
+	case LevelError:
+		return colorRed
+	case LevelWarn:
+		return colorBrown
+	case LevelInfo:
+		return colorGreen
+	default:
+		return colorGray
+	}
+}
+
+// appendIndented append text with every line indented by a tab.
+func appendIndented(b []byte, text string) []byte {
+	b = append(b, '\t')
+	for i := 0; i < len(text); i++ {
+		b = append(b, text[i])
+		if text[i] == '\n' {
+			b = append(b, '\t')
+		}
+	}
+	return b
+}
+
+// pad append spaces, so that text of given length is at least width long.
+func pad(b []byte, length, width int) []byte {
+	for ; length < width; length++ {
+		b = append(b, ' ')
+	}
+	return b
+}
@@ -0,0 +1,20 @@
+package log
+
+import "golang.org/x/net/context"
+
+const contextKey = "log"
+
+// WithLogger return context carrying given logger. Use FromContext to
+// retrieve it back.
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey, l)
+}
+
+// FromContext return logger carried by given context or the standard logger
+// if context does not carry any.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey).(*Logger); ok {
+		return l
+	}
+	return root
+}
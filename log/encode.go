@@ -0,0 +1,153 @@
+package log
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Entry is a single log message.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	// File is the location of the log call in
+	// "<package import path>/<file name>:<line>" format, for example
+	// "github.com/husio/x/auth/handlers.go:42".
+	File string
+	// Function is the name of the function containing the log call,
+	// qualified with the package name, for example "auth.login".
+	Function string
+	// Stack is the stack trace of the log call, one frame per line. It is
+	// set only for messages of level Error, unless one of the fields is an
+	// error carrying its own stack trace.
+	Stack string
+	// Fields are the message context, including fields bound to the logger.
+	// Keys are unique.
+	Fields []Field
+}
+
+// Encoder serialize log entries.
+type Encoder interface {
+	// Encode append serialized entry to dst and return the extended buffer.
+	// Every entry must end with a new line.
+	Encode(dst []byte, e *Entry) []byte
+}
+
+// entries are reused between log messages to avoid allocations.
+var entries = sync.Pool{
+	New: func() interface{} {
+		return &Entry{Fields: make([]Field, 0, 16)}
+	},
+}
+
+func getEntry() *Entry {
+	return entries.Get().(*Entry)
+}
+
+func putEntry(e *Entry) {
+	for i := range e.Fields {
+		// do not keep references to logged values
+		e.Fields[i] = Field{}
+	}
+	*e = Entry{Fields: e.Fields[:0]}
+	entries.Put(e)
+}
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// maxPooledBuffer is the size above which buffers are not reused, so that a
+// single huge message does not keep the memory forever.
+const maxPooledBuffer = 64 << 10
+
+func getBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	buffers.Put(b)
+}
+
+// dates cache formatted date, that changes only once a second.
+var dates struct {
+	sync.Mutex
+	sec  int64
+	text string
+}
+
+// formatDate return date in RFC 3339 format, in UTC.
+func formatDate(t time.Time) string {
+	sec := t.Unix()
+	dates.Lock()
+	defer dates.Unlock()
+	if sec != dates.sec || dates.text == "" {
+		dates.sec = sec
+		dates.text = t.UTC().Format(time.RFC3339)
+	}
+	return dates.text
+}
+
+// uniqueFields remove fields with duplicated key. Value of the last field is
+// kept at the position of the first one. Fields using keys reserved for the
+// entry attributes are removed.
+func uniqueFields(fields []Field) []Field {
+	n := 0
+	for _, f := range fields {
+		switch f.Key {
+		case "date", "level", "msg", "file", "func", "stack":
+			continue
+		}
+		j := 0
+		for j < n && fields[j].Key != f.Key {
+			j++
+		}
+		if j == n {
+			n++
+		}
+		fields[j] = f
+	}
+	return fields[:n]
+}
+
+// appendText append text representation of the scalar field value. Non
+// scalar values are serialized as JSON.
+func appendText(b []byte, f Field) []byte {
+	switch f.kind {
+	case kindString:
+		return append(b, f.str...)
+	case kindInt:
+		return strconv.AppendInt(b, f.num, 10)
+	case kindUint:
+		return strconv.AppendUint(b, uint64(f.num), 10)
+	case kindFloat:
+		return strconv.AppendFloat(b, math.Float64frombits(uint64(f.num)), 'g', -1, 64)
+	case kindBool:
+		return strconv.AppendBool(b, f.num == 1)
+	case kindDuration:
+		return append(b, time.Duration(f.num).String()...)
+	case kindTime:
+		return f.any.(time.Time).AppendFormat(b, time.RFC3339Nano)
+	case kindError:
+		if f.any == nil {
+			return append(b, "null"...)
+		}
+		return append(b, f.any.(error).Error()...)
+	default:
+		raw, err := json.Marshal(f.any)
+		if err != nil {
+			return append(b, "!ERROR: "+err.Error()...)
+		}
+		return append(b, raw...)
+	}
+}
@@ -0,0 +1,73 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func testEntry() *Entry {
+	return &Entry{
+		Time:    time.Date(2016, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		Level:   LevelWarn,
+		Message: "disk almost full",
+		File:    "main.go:12",
+		Fields: []Field{
+			String("path", "/var/my data"),
+			Float64("usage", 0.95),
+			Err(errors.New("no space")),
+			String("empty", ""),
+			String("weird key=", `"quoted"`),
+		},
+	}
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	want := `date=2016-01-02T03:04:05Z level=WARN msg="disk almost full" file=main.go:12 ` +
+		`path="/var/my data" usage=0.95 error="no space" empty="" weird_key_="\"quoted\""` + "\n"
+	if got := string(Logfmt.Encode(nil, testEntry())); got != want {
+		t.Errorf("invalid output\nwant: %s\n got: %s", want, got)
+	}
+}
+
+func TestConsoleEncoder(t *testing.T) {
+	e := testEntry()
+	e.Time = e.Time.Local()
+	e.Fields = e.Fields[:2]
+	want := e.Time.Format("15:04:05.000") + ` WARN  disk almost full                         path="/var/my data" usage=0.95  main.go:12` + "\n"
+	if got := string((&Console{}).Encode(nil, e)); got != want {
+		t.Errorf("invalid output\nwant: %q\n got: %q", want, got)
+	}
+
+	colored := string((&Console{Color: true}).Encode(nil, e))
+	if !bytes.Contains([]byte(colored), []byte(colorBrown+"WARN"+colorReset)) {
+		t.Errorf("want colored level, got %q", colored)
+	}
+}
+
+func TestLoggerEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, &Opts{Encoder: Logfmt})
+	l.Info("hello", "n", 1)
+	if !bytes.Contains(buf.Bytes(), []byte(`level=INFO msg=hello file=github.com/husio/x/log/encoder_test.go:54 func=log.TestLoggerEncoder n=1`)) {
+		t.Errorf("invalid output: %s", buf.String())
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	if IsTerminal(&bytes.Buffer{}) {
+		t.Error("buffer is not a terminal")
+	}
+	f, err := ioutil.TempFile("", "log")
+	if err != nil {
+		t.Fatalf("cannot create file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if IsTerminal(f) {
+		t.Error("regular file is not a terminal")
+	}
+}
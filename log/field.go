@@ -0,0 +1,215 @@
+package log
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/husio/x/errors"
+)
+
+// Field is a single, typed key-value pair of the log message. Fields can be
+// passed to the log functions in place of key and value pair.
+type Field struct {
+	Key  string
+	kind fieldKind
+	num  int64
+	str  string
+	any  interface{}
+}
+
+type fieldKind uint8
+
+const (
+	kindString fieldKind = iota
+	kindInt
+	kindUint
+	kindFloat
+	kindBool
+	kindDuration
+	kindTime
+	kindError
+	kindAny
+)
+
+// String return field with text value.
+func String(key, value string) Field {
+	return Field{Key: key, kind: kindString, str: value}
+}
+
+// Int return field with integer value.
+func Int(key string, value int) Field {
+	return Field{Key: key, kind: kindInt, num: int64(value)}
+}
+
+// Int64 return field with integer value.
+func Int64(key string, value int64) Field {
+	return Field{Key: key, kind: kindInt, num: value}
+}
+
+// Uint64 return field with unsigned integer value.
+func Uint64(key string, value uint64) Field {
+	return Field{Key: key, kind: kindUint, num: int64(value)}
+}
+
+// Float64 return field with floating point value.
+func Float64(key string, value float64) Field {
+	return Field{Key: key, kind: kindFloat, num: int64(math.Float64bits(value))}
+}
+
+// Bool return field with boolean value.
+func Bool(key string, value bool) Field {
+	var n int64
+	if value {
+		n = 1
+	}
+	return Field{Key: key, kind: kindBool, num: n}
+}
+
+// Duration return field with duration value, written as text, for example
+// "1.5s".
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, kind: kindDuration, num: int64(value)}
+}
+
+// Time return field with time value, written in RFC 3339 format.
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, kind: kindTime, any: value}
+}
+
+// Err return field with error message, stored under "error" key. Nil error is
+// written as null.
+//
+// Kind, stack trace and key-value context of errors created by the
+// github.com/husio/x/errors package are written as separate fields: kind and
+// stack under the "error_kind" and "error_stack" keys, context under its own
+// keys.
+func Err(err error) Field {
+	return Field{Key: "error", kind: kindError, any: err}
+}
+
+// Any return field with any value. Value is serialized using its own
+// MarshalJSON method if it implements json.Marshaler, or the encoding/json
+// package rules otherwise.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, kind: kindAny, any: value}
+}
+
+// Value return field value.
+func (f Field) Value() interface{} {
+	switch f.kind {
+	case kindString:
+		return f.str
+	case kindInt:
+		return f.num
+	case kindUint:
+		return uint64(f.num)
+	case kindFloat:
+		return math.Float64frombits(uint64(f.num))
+	case kindBool:
+		return f.num == 1
+	case kindDuration:
+		return time.Duration(f.num)
+	default:
+		return f.any
+	}
+}
+
+// field return field of given key and value, using the most specific kind.
+func field(key string, value interface{}) Field {
+	switch v := value.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint:
+		return Uint64(key, uint64(v))
+	case uint8:
+		return Uint64(key, uint64(v))
+	case uint16:
+		return Uint64(key, uint64(v))
+	case uint32:
+		return Uint64(key, uint64(v))
+	case uint64:
+		return Uint64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case float64:
+		return Float64(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return Field{Key: key, kind: kindError, any: v}
+	default:
+		return Any(key, v)
+	}
+}
+
+// appendFields convert key-value pairs into fields and append them to dst.
+// Field instances take a single position. Missing value of the last key is
+// an empty string.
+func appendFields(dst []Field, keyvals []interface{}) []Field {
+	for i := 0; i < len(keyvals); i++ {
+		if f, ok := keyvals[i].(Field); ok {
+			dst = append(dst, f)
+			if f.kind == kindError {
+				dst = appendErrorFields(dst, f)
+			}
+			continue
+		}
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		if i+1 == len(keyvals) {
+			dst = append(dst, String(key, ""))
+			break
+		}
+		i++
+		f := field(key, keyvals[i])
+		dst = append(dst, f)
+		if f.kind == kindError {
+			dst = appendErrorFields(dst, f)
+		}
+	}
+	return dst
+}
+
+// hasErrorStack return true if any of the fields is an error carrying stack
+// trace.
+func hasErrorStack(fields []Field) bool {
+	for _, f := range fields {
+		if err, ok := f.any.(error); ok && f.kind == kindError && errors.StackOf(err) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// appendErrorFields append kind, stack trace and key-value context carried by
+// the error of given field.
+func appendErrorFields(dst []Field, f Field) []Field {
+	err, _ := f.any.(error)
+	if err == nil {
+		return dst
+	}
+	if kind := errors.KindOf(err); kind != errors.Other {
+		dst = append(dst, String(f.Key+"_kind", kind.String()))
+	}
+	if stack := errors.StackOf(err); stack != nil {
+		dst = append(dst, String(f.Key+"_stack", errors.FormatStack(stack)))
+	}
+	return appendFields(dst, errors.FieldsOf(err))
+}
@@ -0,0 +1,115 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	xerrors "github.com/husio/x/errors"
+)
+
+func TestFieldsEncoding(t *testing.T) {
+	defer testWithTime(time.Time{})()
+
+	var buf bytes.Buffer
+	l := New(&buf, nil).With("request", 42, "user", "bob")
+	keyvals := []interface{}{
+		"user", "ann",
+		"took", 1500 * time.Millisecond,
+		"ratio", 0.5,
+		"ok", true,
+		Err(errors.New("failed")),
+		"at", time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+		"nested", map[string]int{"a": 1},
+		"msg", "ignored",
+		"text", "quote \" and\nline",
+		"orphan",
+	}
+	l.Info("hello", keyvals...)
+
+	want := `{"date":"0001-01-01T00:00:00Z","level":"INFO","msg":"hello","file":"github.com/husio/x/log/field_test.go:32","func":"log.TestFieldsEncoding",` +
+		`"request":42,"user":"ann","took":"1.5s","ratio":0.5,"ok":true,"error":"failed",` +
+		`"at":"2016-01-02T03:04:05Z","nested":{"a":1},"text":"quote \" and\nline","orphan":""}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("invalid output\nwant: %s\n got: %s", want, got)
+	}
+}
+
+func TestAppendJSONValue(t *testing.T) {
+	cases := []struct {
+		field Field
+		want  string
+	}{
+		{Int("a", -3), `-3`},
+		{Uint64("a", math.MaxUint64), `18446744073709551615`},
+		{Float64("a", math.Inf(1)), `"+Inf"`},
+		{Float64("a", math.NaN()), `"NaN"`},
+		{Err(nil), `null`},
+		{Any("a", json.RawMessage(`[1,2]`)), `[1,2]`},
+		{Any("a", make(chan int)), `"!ERROR: json: unsupported type: chan int"`},
+		{String("a", "\x00\u2028\xff"), `"\u0000\u2028` + "\ufffd" + `"`},
+	}
+	for _, tc := range cases {
+		if got := string(appendJSONValue(nil, tc.field)); got != tc.want {
+			t.Errorf("want %s, got %s", tc.want, got)
+		}
+	}
+}
+
+func TestUniqueFields(t *testing.T) {
+	fields := []Field{String("x", "1"), String("msg", "b"), String("y", "2"), String("x", "3")}
+	got := uniqueFields(fields)
+	want := []Field{String("x", "3"), String("y", "2")}
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%d: want %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestLogAllocations(t *testing.T) {
+	l := New(&bytes.Buffer{}, nil)
+	allocs := testing.AllocsPerRun(100, func() {
+		l.Info("message", "n", 1, "s", "text", "ok", true)
+	})
+	if allocs > 1 {
+		t.Errorf("want at most 1 allocation, got %v", allocs)
+	}
+}
+
+func TestErrorFields(t *testing.T) {
+	defer testWithTime(time.Time{})()
+
+	var buf bytes.Buffer
+	l := New(&buf, nil)
+	err := xerrors.Wrap(xerrors.New(xerrors.NotFound, "no user", "user", 42), "cannot login")
+	l.Error("failed", "reason", err, "ip", "127.0.0.1")
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	if got["reason"] != "cannot login: no user" || got["reason_kind"] != "not found" || got["user"] != 42.0 {
+		t.Errorf("unexpected entry: %v", got)
+	}
+	if stack, _ := got["reason_stack"].(string); !strings.Contains(stack, "TestErrorFields") {
+		t.Errorf("unexpected stack: %q", stack)
+	}
+	// stack of the log call is not written, when error carries one
+	if _, ok := got["stack"]; ok {
+		t.Errorf("unexpected log call stack: %v", got["stack"])
+	}
+
+	buf.Reset()
+	l.Error("failed", Err(errors.New("plain")))
+	if want := `"error":"plain","stack":`; !strings.Contains(buf.String(), want) {
+		t.Errorf("unexpected entry: %s", buf.String())
+	}
+}
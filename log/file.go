@@ -0,0 +1,355 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOpts configures rotating file sink.
+type FileOpts struct {
+	// Encoder serialize entries. Defaults to JSON.
+	Encoder Encoder
+	// MaxSize is the size in bytes after which the file is rotated. Zero
+	// means no size limit.
+	MaxSize int64
+	// Interval is the time after which the file is rotated, for example
+	// 24 hours to rotate daily. Rotation times are aligned to multiples of
+	// the interval since zero time, in UTC. Zero disables time based
+	// rotation.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files to keep. Zero means all.
+	MaxBackups int
+	// MaxAge is the time after which rotated file is removed. Zero means
+	// files are not removed because of their age.
+	MaxAge time.Duration
+	// Compress enables gzip compression of rotated files. Files are
+	// compressed in the background.
+	Compress bool
+	// OnError is called when rotated file cannot be compressed or removed
+	// in the background. Defaults to printing the error to stderr.
+	OnError func(error)
+}
+
+// File is a sink writing entries to the file, that is rotated when it grows
+// too big or too old. Rotated files are renamed by appending rotation time to
+// their name, for example "app.log.20160102T150405.000".
+type File struct {
+	path string
+	opts FileOpts
+
+	mu sync.Mutex
+	// fd is nil if file could not be reopened during rotation
+	fd       *os.File
+	size     int64
+	rotateAt time.Time
+	closed   bool
+
+	// compressing is tracking background compression of rotated files,
+	// that is serialized by compressMu
+	compressing sync.WaitGroup
+	compressMu  sync.Mutex
+}
+
+// backupTimeFormat is the rotation time suffix format. It sorts in
+// chronological order.
+const backupTimeFormat = "20060102T150405.000"
+
+// NewFile return sink writing to file of given path. Entries are appended if
+// file already exists.
+func NewFile(path string, o *FileOpts) (*File, error) {
+	var opts FileOpts
+	if o != nil {
+		opts = *o
+	}
+	if opts.Encoder == nil {
+		opts.Encoder = JSON
+	}
+	if opts.OnError == nil {
+		opts.OnError = printError
+	}
+	f := &File{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	fd, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	f.fd = fd
+	f.size = fi.Size()
+	if f.opts.Interval > 0 {
+		f.rotateAt = currentTime().UTC().Truncate(f.opts.Interval).Add(f.opts.Interval)
+	}
+	return nil
+}
+
+func (f *File) Write(e *Entry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = f.opts.Encoder.Encode(*buf, e)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.ready(); err != nil {
+		return err
+	}
+	if f.needsRotation(int64(len(*buf))) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.fd.Write(*buf)
+	f.size += int64(n)
+	return err
+}
+
+// ready return ErrClosed if the sink is closed and reopen the file if it
+// could not be reopened during rotation. Caller must hold the lock.
+func (f *File) ready() error {
+	if f.closed {
+		return ErrClosed
+	}
+	if f.fd == nil {
+		return f.open()
+	}
+	return nil
+}
+
+func (f *File) needsRotation(size int64) bool {
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+size > f.opts.MaxSize {
+		return true
+	}
+	if f.opts.Interval > 0 && !currentTime().Before(f.rotateAt) {
+		return true
+	}
+	return false
+}
+
+// Rotate close current file, rename it and start writing to the new one.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.ready(); err != nil {
+		return err
+	}
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	err := f.fd.Close()
+	f.fd = nil
+	if err != nil {
+		// file descriptor is released even if closing failed
+		if e := f.open(); e != nil {
+			return e
+		}
+		return err
+	}
+
+	now := currentTime()
+	backup := f.backupName(now)
+	if err := os.Rename(f.path, backup); err != nil {
+		// keep writing to the current file
+		if e := f.open(); e != nil {
+			return e
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	if !f.opts.Compress {
+		return f.removeBackups(now)
+	}
+	// compression takes time and must not block writing
+	f.compressing.Add(1)
+	go func() {
+		defer f.compressing.Done()
+		f.compressMu.Lock()
+		defer f.compressMu.Unlock()
+		if err := compressFile(backup); err != nil {
+			f.opts.OnError(fmt.Errorf("cannot compress %s: %s", backup, err))
+			return
+		}
+		if err := f.removeBackups(now); err != nil {
+			f.opts.OnError(err)
+		}
+	}()
+	return nil
+}
+
+// backupName return name for the file rotated at given time. If files
+// rotated at the same time exist, name is suffixed with the sequence number.
+func (f *File) backupName(now time.Time) string {
+	now = now.UTC()
+	base := f.path + "." + now.Format(backupTimeFormat)
+	seq := -1
+	backups, _ := f.Backups()
+	for _, path := range backups {
+		if t, n, _ := f.parseBackup(path); t.Equal(now) && n > seq {
+			seq = n
+		}
+	}
+	if seq < 0 {
+		return base
+	}
+	return base + "-" + strconv.Itoa(seq+1)
+}
+
+// compressFile replace file with its gzip compressed version.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Backups return paths of all rotated files, oldest first.
+func (f *File) Backups() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, path := range matches {
+		if _, _, ok := f.parseBackup(path); ok {
+			backups = append(backups, path)
+		}
+	}
+	sort.Sort(byRotation{f: f, paths: backups})
+	return backups, nil
+}
+
+// parseBackup return rotation time and sequence number of given backup file.
+func (f *File) parseBackup(path string) (time.Time, int, bool) {
+	suffix := strings.TrimSuffix(strings.TrimPrefix(path, f.path+"."), ".gz")
+	if len(suffix) < len(backupTimeFormat) {
+		return time.Time{}, 0, false
+	}
+	t, err := time.Parse(backupTimeFormat, suffix[:len(backupTimeFormat)])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	suffix = suffix[len(backupTimeFormat):]
+	if suffix == "" {
+		return t, 0, true
+	}
+	if suffix[0] != '-' {
+		return time.Time{}, 0, false
+	}
+	seq, err := strconv.Atoi(suffix[1:])
+	return t, seq, err == nil
+}
+
+type byRotation struct {
+	f     *File
+	paths []string
+}
+
+func (b byRotation) Len() int      { return len(b.paths) }
+func (b byRotation) Swap(i, j int) { b.paths[i], b.paths[j] = b.paths[j], b.paths[i] }
+func (b byRotation) Less(i, j int) bool {
+	ti, si, _ := b.f.parseBackup(b.paths[i])
+	tj, sj, _ := b.f.parseBackup(b.paths[j])
+	if ti.Equal(tj) {
+		return si < sj
+	}
+	return ti.Before(tj)
+}
+
+// removeBackups remove rotated files exceeding retention limits.
+func (f *File) removeBackups(now time.Time) error {
+	if f.opts.MaxBackups <= 0 && f.opts.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+	var remove []string
+	if n := len(backups) - f.opts.MaxBackups; f.opts.MaxBackups > 0 && n > 0 {
+		remove, backups = backups[:n], backups[n:]
+	}
+	if f.opts.MaxAge > 0 {
+		for _, path := range backups {
+			if t, _, _ := f.parseBackup(path); now.Sub(t) > f.opts.MaxAge {
+				remove = append(remove, path)
+			}
+		}
+	}
+	for _, path := range remove {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush commit written entries to the storage.
+func (f *File) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.ready(); err != nil {
+		return err
+	}
+	return f.fd.Sync()
+}
+
+// Close close the file and wait until compression of rotated files is done.
+func (f *File) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrClosed
+	}
+	f.closed = true
+	var err error
+	if f.fd != nil {
+		err = f.fd.Close()
+		f.fd = nil
+	}
+	f.mu.Unlock()
+
+	f.compressing.Wait()
+	return err
+}
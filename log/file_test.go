@@ -0,0 +1,147 @@
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFile(t *testing.T, opts *FileOpts) (*File, string, func()) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("cannot create directory: %s", err)
+	}
+	path := filepath.Join(dir, "app.log")
+	f, err := NewFile(path, opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("cannot open file: %s", err)
+	}
+	return f, path, func() {
+		f.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileSizeRotation(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer testWithTime(now)()
+
+	f, path, done := testFile(t, &FileOpts{MaxSize: 300, MaxBackups: 2})
+	defer done()
+
+	l := New(nil, &Opts{Sinks: []Sink{f}})
+	for i := 0; i < 10; i++ {
+		l.Info("message")
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatalf("cannot list backups: %s", err)
+	}
+	want := []string{path + "." + "20160102T030405.000-2", path + "." + "20160102T030405.000-3"}
+	if strings.Join(backups, " ") != strings.Join(want, " ") {
+		t.Errorf("want %v, got %v", want, backups)
+	}
+	for _, p := range append(backups, path) {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("cannot stat: %s", err)
+		}
+		if fi.Size() > 300 {
+			t.Errorf("%s is too big: %d", p, fi.Size())
+		}
+	}
+}
+
+func TestFileTimeRotation(t *testing.T) {
+	now := time.Date(2016, 1, 2, 23, 59, 0, 0, time.UTC)
+	defer testWithTime(now)()
+
+	f, path, done := testFile(t, &FileOpts{Interval: 24 * time.Hour, MaxAge: 36 * time.Hour, Compress: true})
+	defer done()
+	l := New(nil, &Opts{Sinks: []Sink{f}})
+
+	l.Info("first day")
+	for day := 1; day <= 3; day++ {
+		currentTime = func() time.Time { return now.Add(time.Duration(day) * 24 * time.Hour) }
+		l.Info("next day")
+	}
+	f.compressing.Wait()
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatalf("cannot list backups: %s", err)
+	}
+	want := []string{path + ".20160104T235900.000.gz", path + ".20160105T235900.000.gz"}
+	if strings.Join(backups, " ") != strings.Join(want, " ") {
+		t.Errorf("want %v, got %v", want, backups)
+	}
+
+	fd, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatalf("cannot open: %s", err)
+	}
+	defer fd.Close()
+	gz, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatalf("cannot read gzip: %s", err)
+	}
+	b, err := ioutil.ReadAll(gz)
+	if err != nil || !strings.Contains(string(b), "next day") {
+		t.Errorf("invalid backup content: %q, %v", b, err)
+	}
+}
+
+func TestFileCloseWaitsForCompression(t *testing.T) {
+	f, path, done := testFile(t, &FileOpts{Compress: true})
+	defer done()
+
+	l := New(nil, &Opts{Sinks: []Sink{f}})
+	l.Info(strings.Repeat("x", 1<<20))
+	if err := f.Rotate(); err != nil {
+		t.Fatalf("cannot rotate: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("cannot close: %s", err)
+	}
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatalf("cannot list backups: %s", err)
+	}
+	if len(backups) != 1 || !strings.HasPrefix(backups[0], path) || !strings.HasSuffix(backups[0], ".gz") {
+		t.Errorf("want single compressed backup, got %v", backups)
+	}
+}
+
+func TestFileRecoversFromCloseError(t *testing.T) {
+	f, path, done := testFile(t, nil)
+	defer done()
+
+	// closing the descriptor behind the sink makes rotation fail
+	f.fd.Close()
+	if err := f.Rotate(); err == nil {
+		t.Fatal("want close error")
+	}
+	if err := f.Write(&Entry{Message: "after"}); err != nil {
+		t.Fatalf("cannot write: %s", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read: %s", err)
+	}
+	if !strings.Contains(string(b), "after") {
+		t.Errorf("entry not written: %q", b)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("cannot close: %s", err)
+	}
+	if err := f.Write(&Entry{Message: "closed"}); err != ErrClosed {
+		t.Errorf("want ErrClosed, got %v", err)
+	}
+}
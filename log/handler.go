@@ -0,0 +1,59 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// LevelHandler return HTTP handler for inspecting and changing log thresholds
+// at runtime. It is meant to be mounted on the admin interface only.
+//
+// GET request returns JSON encoded global and package thresholds. POST or
+// PUT request with "level" form value changes the global threshold or, if
+// "package" value is given as well, threshold of that package. Package
+// override is removed if level is empty.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(serveLevels)
+}
+
+func serveLevels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST", "PUT":
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "cannot parse form", http.StatusBadRequest)
+			return
+		}
+		pkg, raw := r.Form.Get("package"), r.Form.Get("level")
+		if pkg != "" && raw == "" {
+			ResetPackageLevel(pkg)
+			break
+		}
+		level, err := ParseLevel(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if pkg == "" {
+			SetLevel(level)
+		} else {
+			SetPackageLevel(pkg, level)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := struct {
+		Level    Level            `json:"level"`
+		Packages map[string]Level `json:"packages"`
+	}{
+		Level:    GetLevel(),
+		Packages: PackageLevels(),
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		Error("cannot write log levels", Err(err))
+	}
+}
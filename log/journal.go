@@ -0,0 +1,157 @@
+package log
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JournalOpts configures journald sink.
+type JournalOpts struct {
+	// Path of the journald socket. Defaults to
+	// "/run/systemd/journal/socket".
+	Path string
+	// Identifier is the SYSLOG_IDENTIFIER of messages. Defaults to the
+	// program name.
+	Identifier string
+}
+
+// Journal is a sink sending entries to journald using its native protocol.
+// Message fields are sent as journal fields, with names converted to upper
+// case and characters other than letters, digits and underscore replaced.
+//
+// Every entry is sent as a single datagram, so its size is limited by the
+// socket buffer size.
+type Journal struct {
+	opts JournalOpts
+
+	mu sync.Mutex
+	cn *net.UnixConn
+}
+
+// NewJournal return sink connected to journald.
+func NewJournal(o *JournalOpts) (*Journal, error) {
+	var opts JournalOpts
+	if o != nil {
+		opts = *o
+	}
+	if opts.Path == "" {
+		opts.Path = "/run/systemd/journal/socket"
+	}
+	if opts.Identifier == "" {
+		opts.Identifier = filepath.Base(os.Args[0])
+	}
+	cn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: opts.Path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{opts: opts, cn: cn}, nil
+}
+
+func (j *Journal) Write(e *Entry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = j.encode(*buf, e)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cn == nil {
+		return ErrClosed
+	}
+	_, err := j.cn.Write(*buf)
+	return err
+}
+
+// encode append entry serialized using journald native protocol.
+func (j *Journal) encode(b []byte, e *Entry) []byte {
+	b = appendJournalField(b, "MESSAGE", e.Message)
+	b = append(b, "PRIORITY="...)
+	b = strconv.AppendInt(b, int64(severity(e.Level)), 10)
+	b = append(b, '\n')
+	b = appendJournalField(b, "SYSLOG_IDENTIFIER", j.opts.Identifier)
+	if i := strings.LastIndex(e.File, ":"); i > 0 {
+		b = appendJournalField(b, "CODE_FILE", e.File[:i])
+		b = appendJournalField(b, "CODE_LINE", e.File[i+1:])
+	}
+	if e.Function != "" {
+		b = appendJournalField(b, "CODE_FUNC", e.Function)
+	}
+	for _, f := range e.Fields {
+		b = appendJournalField(b, journalName(f.Key), string(appendText(nil, f)))
+	}
+	if e.Stack != "" {
+		b = appendJournalField(b, "STACK", e.Stack)
+	}
+	return b
+}
+
+// appendJournalField append field in "NAME=value\n" format or, if the value
+// contains new line, in binary safe format with value size prefix.
+func appendJournalField(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	if strings.IndexByte(value, '\n') < 0 {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b = append(b, size[:]...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// journalName return valid journal field name, that consists of upper case
+// letters, digits and underscores and does not start with underscore or
+// digit. Names of fields set by the sink itself or with special meaning for
+// journald are prefixed, so that they are not overwritten.
+func journalName(key string) string {
+	b := make([]byte, 0, len(key)+2)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			b = append(b, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			b = append(b, c)
+		default:
+			b = append(b, '_')
+		}
+	}
+	if len(b) == 0 || b[0] == '_' || (b[0] >= '0' && b[0] <= '9') || reservedJournalName(string(b)) {
+		b = append([]byte("F_"), b...)
+	}
+	// longer names are ignored by journald
+	if len(b) > 64 {
+		b = b[:64]
+	}
+	return string(b)
+}
+
+func reservedJournalName(name string) bool {
+	switch name {
+	case "MESSAGE", "MESSAGE_ID", "PRIORITY", "ERRNO", "STACK":
+		return true
+	}
+	return strings.HasPrefix(name, "CODE_") || strings.HasPrefix(name, "SYSLOG_")
+}
+
+func (j *Journal) Flush() error {
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cn == nil {
+		return ErrClosed
+	}
+	err := j.cn.Close()
+	j.cn = nil
+	return err
+}
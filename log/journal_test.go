@@ -0,0 +1,78 @@
+package log
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("cannot create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.sock")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer ln.Close()
+
+	j, err := NewJournal(&JournalOpts{Path: path, Identifier: "app"})
+	if err != nil {
+		t.Fatalf("cannot connect: %s", err)
+	}
+	defer j.Close()
+
+	err = j.Write(&Entry{
+		Level:   LevelError,
+		Message: "failed",
+		File:    "main.go:12",
+		Stack:   "a\nb",
+		Fields: []Field{
+			Int("request-id", 7),
+			String("_private", "x"),
+			String("message", "user"),
+			String("priority", "high"),
+			String("code_file", "x.go"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot write: %s", err)
+	}
+
+	buf := make([]byte, 1024)
+	ln.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := ln.Read(buf)
+	if err != nil {
+		t.Fatalf("cannot read: %s", err)
+	}
+	want := "MESSAGE=failed\nPRIORITY=3\nSYSLOG_IDENTIFIER=app\nCODE_FILE=main.go\nCODE_LINE=12\n" +
+		"REQUEST_ID=7\nF__PRIVATE=x\nF_MESSAGE=user\nF_PRIORITY=high\nF_CODE_FILE=x.go\n" +
+		"STACK\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("invalid message\nwant: %q\n got: %q", want, got)
+	}
+}
+
+func TestJournalName(t *testing.T) {
+	long := strings.Repeat("x", 70)
+	cases := map[string]string{
+		"request-id":     "REQUEST_ID",
+		"message":        "F_MESSAGE",
+		"9lives":         "F_9LIVES",
+		long:             strings.Repeat("X", 64),
+		"code_" + long:   "F_CODE_" + strings.Repeat("X", 57),
+		"syslog_" + long: "F_SYSLOG_" + strings.Repeat("X", 55),
+	}
+	for key, want := range cases {
+		if got := journalName(key); got != want {
+			t.Errorf("%s: want %q, got %q", key, want, got)
+		}
+	}
+}
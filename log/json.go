@@ -0,0 +1,125 @@
+package log
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// JSON encoder writes every entry as single line JSON object, with date,
+// level, msg, file and func keys first. Stack trace, if present, is written
+// last, under the stack key.
+var JSON Encoder = jsonEncoder{}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(b []byte, e *Entry) []byte {
+	b = append(b, `{"date":"`...)
+	b = append(b, formatDate(e.Time)...)
+	b = append(b, `","level":`...)
+	b = appendJSONString(b, e.Level.String())
+	b = append(b, `,"msg":`...)
+	b = appendJSONString(b, e.Message)
+	b = append(b, `,"file":`...)
+	b = appendJSONString(b, e.File)
+	if e.Function != "" {
+		b = append(b, `,"func":`...)
+		b = appendJSONString(b, e.Function)
+	}
+	for _, f := range e.Fields {
+		b = append(b, ',')
+		b = appendJSONString(b, f.Key)
+		b = append(b, ':')
+		b = appendJSONValue(b, f)
+	}
+	if e.Stack != "" {
+		b = append(b, `,"stack":`...)
+		b = appendJSONString(b, e.Stack)
+	}
+	return append(b, '}', '\n')
+}
+
+func appendJSONValue(b []byte, f Field) []byte {
+	switch f.kind {
+	case kindString:
+		return appendJSONString(b, f.str)
+	case kindInt, kindUint, kindBool:
+		return appendText(b, f)
+	case kindFloat:
+		v := math.Float64frombits(uint64(f.num))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			// not representable as JSON number
+			return appendJSONString(b, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(b, v, 'g', -1, 64)
+	case kindDuration, kindTime:
+		b = append(b, '"')
+		b = appendText(b, f)
+		return append(b, '"')
+	case kindError:
+		if f.any == nil {
+			return append(b, "null"...)
+		}
+		return appendJSONString(b, f.any.(error).Error())
+	default:
+		raw, err := json.Marshal(f.any)
+		if err != nil {
+			return appendJSONString(b, "!ERROR: "+err.Error())
+		}
+		return append(b, raw...)
+	}
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString append quoted and escaped text. Invalid UTF-8 sequences
+// are replaced with the replacement character.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// line and paragraph separators break JavaScript parsers
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,194 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is the importance of the log message. Messages below the threshold
+// are discarded.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+}
+
+// ParseLevel return level of given name. Name is case insensitive.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	level, err := ParseLevel(string(b))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// minLevel is the global threshold, accessed atomically.
+var minLevel = int32(LevelDebug)
+
+// SetLevel set the global threshold. Messages of lower level are discarded,
+// unless package or logger override allows them.
+func SetLevel(l Level) {
+	atomic.StoreInt32(&minLevel, int32(l))
+}
+
+// GetLevel return the global threshold.
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&minLevel))
+}
+
+var pkgLevels = struct {
+	mu sync.RWMutex
+	m  map[string]Level
+	// n is the number of overrides, accessed atomically, so that the
+	// caller's package is resolved only if it can make a difference.
+	n int32
+}{m: make(map[string]Level)}
+
+// SetPackageLevel set threshold for messages logged by code of given package
+// and all its subpackages, for example "github.com/husio/x/auth". Package
+// threshold takes precedence over the global one.
+func SetPackageLevel(pkg string, l Level) {
+	pkgLevels.mu.Lock()
+	pkgLevels.m[pkg] = l
+	atomic.StoreInt32(&pkgLevels.n, int32(len(pkgLevels.m)))
+	pkgLevels.mu.Unlock()
+}
+
+// ResetPackageLevel remove threshold override of given package.
+func ResetPackageLevel(pkg string) {
+	pkgLevels.mu.Lock()
+	delete(pkgLevels.m, pkg)
+	atomic.StoreInt32(&pkgLevels.n, int32(len(pkgLevels.m)))
+	pkgLevels.mu.Unlock()
+}
+
+// PackageLevels return all package threshold overrides.
+func PackageLevels() map[string]Level {
+	pkgLevels.mu.RLock()
+	defer pkgLevels.mu.RUnlock()
+	levels := make(map[string]Level, len(pkgLevels.m))
+	for pkg, l := range pkgLevels.m {
+		levels[pkg] = l
+	}
+	return levels
+}
+
+// packageLevel return threshold override of the most specific package
+// containing given one.
+func packageLevel(pkg string) (Level, bool) {
+	pkgLevels.mu.RLock()
+	defer pkgLevels.mu.RUnlock()
+	for {
+		if l, ok := pkgLevels.m[pkg]; ok {
+			return l, true
+		}
+		i := strings.LastIndex(pkg, "/")
+		if i < 0 {
+			return 0, false
+		}
+		pkg = pkg[:i]
+	}
+}
+
+// funcPackage return import path of the package containing function of
+// given fully qualified name.
+func funcPackage(name string) string {
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+// PackageLevel is threshold override of a single package. It can be loaded
+// from text in "<package>=<level>" format, for example
+// "github.com/husio/x/auth=debug".
+type PackageLevel struct {
+	Package string
+	Level   Level
+}
+
+func (p PackageLevel) MarshalText() ([]byte, error) {
+	return []byte(p.Package + "=" + p.Level.String()), nil
+}
+
+func (p *PackageLevel) UnmarshalText(b []byte) error {
+	chunks := strings.SplitN(string(b), "=", 2)
+	if len(chunks) != 2 || chunks[0] == "" {
+		return fmt.Errorf("invalid package level %q", b)
+	}
+	level, err := ParseLevel(chunks[1])
+	if err != nil {
+		return err
+	}
+	p.Package = strings.TrimSpace(chunks[0])
+	p.Level = level
+	return nil
+}
+
+// Config describes log thresholds and can be loaded from environment
+// variables using envconf:
+//
+//	var conf log.Config
+//	envconf.Must(envconf.LoadEnv(&conf))
+//	conf.Apply()
+//
+// For example LOG_LEVEL=warn LOG_PACKAGES="github.com/husio/x/auth=debug".
+type Config struct {
+	Level    Level          `envconf:"LOG_LEVEL"`
+	Packages []PackageLevel `envconf:"LOG_PACKAGES"`
+}
+
+// Apply set global and package thresholds. Existing package overrides are
+// removed.
+func (c *Config) Apply() {
+	pkgLevels.mu.Lock()
+	pkgLevels.m = make(map[string]Level, len(c.Packages))
+	for _, p := range c.Packages {
+		pkgLevels.m[p.Package] = p.Level
+	}
+	atomic.StoreInt32(&pkgLevels.n, int32(len(pkgLevels.m)))
+	pkgLevels.mu.Unlock()
+
+	SetLevel(c.Level)
+}
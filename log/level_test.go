@@ -0,0 +1,143 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/husio/x/envconf"
+)
+
+func TestLevelThreshold(t *testing.T) {
+	read, close := catchLoggerOut()
+	defer close()
+	defer SetLevel(GetLevel())
+
+	SetLevel(LevelWarn)
+	Debug("debug")
+	Info("info")
+	if out := read(); len(out) != 0 {
+		t.Errorf("want no output, got %q", out)
+	}
+	Warn("warn")
+	if out := read(); !strings.Contains(string(out), `"WARN"`) {
+		t.Errorf("want warning, got %q", out)
+	}
+
+	SetPackageLevel("github.com/husio/x", LevelDebug)
+	Debug("debug")
+	if out := read(); len(out) == 0 {
+		t.Error("want package override to enable debug")
+	}
+	SetPackageLevel("github.com/husio/x/log", LevelError)
+	Warn("warn")
+	if out := read(); len(out) != 0 {
+		t.Errorf("want more specific package override, got %q", out)
+	}
+	ResetPackageLevel("github.com/husio/x/log")
+	ResetPackageLevel("github.com/husio/x")
+	if levels := PackageLevels(); len(levels) != 0 {
+		t.Errorf("want no overrides, got %v", levels)
+	}
+
+	root.SetLevel(LevelDebug)
+	Debug("debug")
+	if out := read(); len(out) == 0 {
+		t.Error("want logger override to enable debug")
+	}
+	root.ResetLevel()
+	Debug("debug")
+	if out := read(); len(out) != 0 {
+		t.Errorf("want no output, got %q", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "INFO", "Warn", "warning", "error"} {
+		var l Level
+		if err := l.UnmarshalText([]byte(name)); err != nil {
+			t.Errorf("cannot parse %q: %s", name, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("want error")
+	}
+
+	var p PackageLevel
+	if err := p.UnmarshalText([]byte("github.com/husio/x/auth=info")); err != nil {
+		t.Fatalf("cannot parse: %s", err)
+	}
+	if p.Package != "github.com/husio/x/auth" || p.Level != LevelInfo {
+		t.Errorf("invalid package level: %+v", p)
+	}
+	if err := p.UnmarshalText([]byte("info")); err == nil {
+		t.Error("want error")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	defer SetLevel(GetLevel())
+	defer ResetPackageLevel("github.com/husio/x/auth")
+
+	h := LevelHandler()
+	update := func(form url.Values) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := update(url.Values{"level": {"warn"}}); w.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := update(url.Values{"level": {"debug"}, "package": {"github.com/husio/x/auth"}}); w.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := update(url.Values{"level": {"loud"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("want 400, got %d", w.Code)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var resp struct {
+		Level    string
+		Packages map[string]string
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("cannot decode response: %s", err)
+	}
+	if resp.Level != "WARN" || resp.Packages["github.com/husio/x/auth"] != "DEBUG" {
+		t.Errorf("invalid response: %+v", resp)
+	}
+
+	update(url.Values{"package": {"github.com/husio/x/auth"}})
+	if levels := PackageLevels(); len(levels) != 0 {
+		t.Errorf("want no overrides, got %v", levels)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	defer SetLevel(GetLevel())
+	defer ResetPackageLevel("github.com/husio/x/auth")
+
+	var conf Config
+	err := envconf.Load(&conf, map[string]string{
+		"LOG_LEVEL":    "error",
+		"LOG_PACKAGES": "github.com/husio/x/auth=debug",
+	})
+	if err != nil {
+		t.Fatalf("cannot load config: %s", err)
+	}
+	conf.Apply()
+	if l := GetLevel(); l != LevelError {
+		t.Errorf("want ERROR, got %s", l)
+	}
+	if l, ok := PackageLevels()["github.com/husio/x/auth"]; !ok || l != LevelDebug {
+		t.Errorf("want DEBUG, got %s", l)
+	}
+}
@@ -1,93 +1,306 @@
 // Package log implements simple key-value logging package.
 //
-// Package defines two log levels:
+// Package defines four log levels:
 // - debug messages used for debug purposes
+// - info messages describing normal operation
+// - warn messages about unexpected state that does not require attention yet
 // - error messages that contains important information that require attention
 //
-// Output is formatted as flat JSON object containing only string values.
+// Messages below the threshold are discarded. Threshold can be set globally,
+// for a package or for a logger and changed at runtime, see SetLevel,
+// SetPackageLevel and LevelHandler.
+//
+// Every message is written together with the location and function name of
+// the log call. Messages of level Error include the stack trace, unless
+// logged error carries one, see Err. Wrapping functions can be skipped when
+// resolving the location using Helper.
+//
+// Package level functions are using the standard logger writing to stdout.
+// Use New to create logger writing elsewhere and With to create child logger
+// that is binding key-value pairs to every message. Request scoped logger can
+// be passed using WithLogger and FromContext.
+//
+// Message context is passed as key-value pairs. Value can be of any type and
+// is serialized according to its type, see Field. Context keys are written in
+// the order they were given. If the key is repeated, the last value is
+// written.
+//
+// By default output is formatted as single line JSON object. Logfmt and
+// Console encoders can be used instead, see Opts. Besides the writer, entries
+// can be written to any number of sinks, for example rotated files (File)
+// or in the background (Async).
 package log
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"path"
-	"runtime"
+	"sync/atomic"
 	"time"
+
+	"github.com/husio/x/errors"
 )
 
-var root = newLogger(os.Stdout, 3)
+var root = New(os.Stdout, nil)
 
-// Error logs a message at level Error on the standard logger.
-func Error(msg string, keyvals ...string) {
-	root.Error(msg, keyvals...)
+// Default return the standard logger used by package level functions.
+func Default() *Logger {
+	return root
+}
+
+// SetDefault replace the standard logger used by package level functions.
+// It is not safe to call it concurrently with logging, so it should be
+// called during the program initialization.
+func SetDefault(l *Logger) {
+	root = l
+}
+
+// With return child of the standard logger, see Logger.With.
+func With(keyvals ...interface{}) *Logger {
+	return root.With(keyvals...)
 }
 
 // Debug logs a message at level Debug on the standard logger.
-func Debug(msg string, keyvals ...string) {
-	root.Debug(msg, keyvals...)
+func Debug(msg string, keyvals ...interface{}) {
+	root.log(LevelDebug, msg, keyvals)
+}
+
+// Info logs a message at level Info on the standard logger.
+func Info(msg string, keyvals ...interface{}) {
+	root.log(LevelInfo, msg, keyvals)
 }
 
-// Fatal is equivalent to Error() followed by a call to os.Exit(1).
-func Fatal(msg string, keyvals ...string) {
-	root.Error(msg, keyvals...)
-	os.Exit(1)
+// Warn logs a message at level Warn on the standard logger.
+func Warn(msg string, keyvals ...interface{}) {
+	root.log(LevelWarn, msg, keyvals)
 }
 
-type logger struct {
+// Error logs a message at level Error on the standard logger.
+func Error(msg string, keyvals ...interface{}) {
+	root.log(LevelError, msg, keyvals)
+}
+
+// Fatal is equivalent to Error() followed by a call to os.Exit(1). Entries
+// buffered by the sinks are written before exiting.
+func Fatal(msg string, keyvals ...interface{}) {
+	root.fatal(msg, keyvals)
+}
+
+// Logger writes key-value messages. Logger is safe for concurrent use.
+type Logger struct {
+	// callDepth is the number of stack frames between caller and the log
+	// method
 	callDepth int
-	write     func(interface{}) error
+	sink      Sink
+	onError   func(error)
+	// sampler, if set, is shared with all children of the logger
+	sampler *sampler
+	// level is the threshold override, accessed atomically. Negative value
+	// means no override. It is shared with all children of the logger.
+	level *int32
+	// fields are bound to every message written by the logger
+	fields []Field
 }
 
-func newLogger(w io.Writer, callDepth int) *logger {
-	return &logger{
-		callDepth: callDepth,
-		write:     json.NewEncoder(w).Encode,
-	}
+// Opts configures the logger.
+type Opts struct {
+	// Encoder serialize entries written to the writer. Defaults to JSON.
+	Encoder Encoder
+	// Sinks receive all entries, in addition to the writer.
+	Sinks []Sink
+	// OnError is called when entry cannot be written. Defaults to printing
+	// the error to stderr.
+	OnError func(error)
+	// Sampling, if set, limits the number of identical messages written.
+	// Fatal messages are never suppressed.
+	Sampling *SampleOpts
 }
 
-func (l *logger) Error(msg string, keyvals ...string) {
-	if len(keyvals)%2 != 0 {
-		keyvals = append(keyvals, "")
+// New return logger writing messages to given writer and all sinks
+// configured by options. Writer can be nil if sinks are provided.
+func New(w io.Writer, o *Opts) *Logger {
+	var opts Opts
+	if o != nil {
+		opts = *o
+	}
+	if opts.Encoder == nil {
+		opts.Encoder = JSON
+	}
+	if opts.OnError == nil {
+		opts.OnError = printError
 	}
-	keyvals = append(keyvals, "msg", msg, "level", "ERROR")
-	l.log(keyvals)
+	sinks := opts.Sinks
+	if w != nil {
+		sinks = append([]Sink{NewWriterSink(w, opts.Encoder)}, sinks...)
+	}
+	level := int32(-1)
+	l := &Logger{
+		callDepth: 2,
+		sink:      Tee(sinks...),
+		onError:   opts.OnError,
+		level:     &level,
+	}
+	if opts.Sampling != nil {
+		l.sampler = newSampler(opts.Sampling, l.writeSummary)
+	}
+	return l
 }
 
-func (l *logger) Debug(msg string, keyvals ...string) {
-	if len(keyvals)%2 != 0 {
-		keyvals = append(keyvals, "")
+// writeSummary write entry reporting number of suppressed messages.
+func (l *Logger) writeSummary(key sampleKey, level Level, suppressed int) {
+	e := getEntry()
+	defer putEntry(e)
+	e.Time = currentTime()
+	e.Level = level
+	e.Message = "messages suppressed"
+	e.File = key.file
+	e.Fields = append(e.Fields, String("sampled_msg", key.msg), Int("suppressed", suppressed))
+	if err := l.sink.Write(e); err != nil {
+		l.onError(err)
 	}
-	keyvals = append(keyvals, "msg", msg, "level", "DEBUG")
-	l.log(keyvals)
 }
 
-func (l *logger) log(keyvals []string) {
-	now := currentTime().UTC().Format(time.RFC3339)
+func printError(err error) {
+	fmt.Fprintf(os.Stderr, "cannot write log message: %s\n", err)
+}
 
-	file := "???:0"
-	if _, name, line, ok := runtime.Caller(l.callDepth); ok {
-		_, name = path.Split(name)
-		file = fmt.Sprintf("%s:%d", name, line)
+// Flush write summary of suppressed messages and all entries buffered by the
+// sinks of the logger.
+func (l *Logger) Flush() error {
+	if l.sampler != nil {
+		l.sampler.Flush()
 	}
+	return l.sink.Flush()
+}
 
-	keyvals = append(keyvals, "date", now, "file", file)
-	pairs := convertToPairs(keyvals)
-	if err := l.write(pairs); err != nil {
-		fmt.Fprintf(os.Stderr, "cannot write log message: %s\n", err)
-		fmt.Fprintf(os.Stderr, "%v\n", keyvals)
+// Close flush and close all sinks of the logger. Logger and all its children
+// must not be used after closing.
+func (l *Logger) Close() error {
+	if l.sampler != nil {
+		l.sampler.Flush()
 	}
+	return l.sink.Close()
 }
 
-// we want to mock current time in tests
-var currentTime = time.Now
+// With return child logger, that is writing given key-value pairs together
+// with every message. Child is sharing sinks and threshold with its parent.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	child := *l
+	child.fields = make([]Field, len(l.fields), len(l.fields)+len(keyvals))
+	copy(child.fields, l.fields)
+	child.fields = appendFields(child.fields, keyvals)
+	return &child
+}
 
-func convertToPairs(keyvals []string) map[string]string {
-	pairs := make(map[string]string)
-	for i := 0; i < len(keyvals); i += 2 {
-		pairs[keyvals[i]] = keyvals[i+1]
+// WithCallerSkip return child logger, that is skipping given number of
+// additional stack frames when resolving the location of the log call. Use
+// it for wrappers calling the logger, or mark wrapper functions by Helper.
+func (l *Logger) WithCallerSkip(skip int) *Logger {
+	child := *l
+	child.callDepth += skip
+	return &child
+}
+
+// SetLevel set threshold of the logger, that takes precedence over package
+// and global thresholds.
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+// ResetLevel remove threshold override of the logger.
+func (l *Logger) ResetLevel() {
+	atomic.StoreInt32(l.level, -1)
+}
+
+// Debug logs a message at level Debug.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info logs a message at level Info.
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn logs a message at level Warn.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error logs a message at level Error.
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// Fatal is equivalent to Error() followed by a call to os.Exit(1). Entries
+// buffered by the sinks are written before exiting.
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.fatal(msg, keyvals)
+}
+
+func (l *Logger) fatal(msg string, keyvals []interface{}) {
+	unsampled := *l
+	unsampled.sampler = nil
+	// fatal is one more frame between the caller and the log method
+	unsampled.callDepth++
+	unsampled.log(LevelError, msg, keyvals)
+	if err := l.Flush(); err != nil {
+		l.onError(err)
+	}
+	exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	// without package overrides threshold does not depend on the caller and
+	// message can be discarded before the expensive caller lookup
+	if atomic.LoadInt32(&pkgLevels.n) == 0 && level < l.threshold("") {
+		return
+	}
+	c, stack := callStack(l.callDepth, level >= LevelError)
+	if level < l.threshold(c.pkg) {
+		return
+	}
+	if l.sampler != nil && !l.sampler.allow(level, msg, c.file) {
+		return
+	}
+
+	e := getEntry()
+	defer putEntry(e)
+
+	e.Time = currentTime()
+	e.Level = level
+	e.Message = msg
+	e.File = c.file
+	e.Function = c.function
+	e.Fields = append(e.Fields, l.fields...)
+	e.Fields = appendFields(e.Fields, keyvals)
+	e.Fields = uniqueFields(e.Fields)
+	// stack of the logged error is more useful than the one of the log call
+	if stack != nil && !hasErrorStack(e.Fields) {
+		e.Stack = errors.FormatStack(stack)
 	}
 
-	return pairs
+	if err := l.sink.Write(e); err != nil {
+		l.onError(err)
+	}
 }
+
+// threshold return minimal level of messages logged by code of given
+// package.
+func (l *Logger) threshold(pkg string) Level {
+	if override := atomic.LoadInt32(l.level); override >= 0 {
+		return Level(override)
+	}
+	if atomic.LoadInt32(&pkgLevels.n) != 0 {
+		if min, ok := packageLevel(pkg); ok {
+			return min
+		}
+	}
+	return GetLevel()
+}
+
+// we want to mock current time in tests
+var currentTime = time.Now
+
+// we want to test Fatal without terminating the program
+var exit = os.Exit
@@ -22,6 +22,11 @@ func TestLogger(t *testing.T) {
 			t.Errorf("%s: cannot unmarshal json: %s", tname, err)
 			continue
 		}
+		// stack trace depends on the test runner
+		if stack := got["stack"]; (stack != "") != (tc.Want["level"] == "ERROR") {
+			t.Errorf("%s: unexpected stack: %q", tname, stack)
+		}
+		delete(got, "stack")
 		if !reflect.DeepEqual(got, tc.Want) {
 			t.Errorf("%s failed\ngot: %#v\nexpected:%#v",
 				tname, got, tc.Want)
@@ -32,55 +37,84 @@ func TestLogger(t *testing.T) {
 // This is declared outside the test case to ensure the line
 // number stays constant.
 var cases = map[string]struct {
-	Log     func(msg string, keyvals ...string)
+	Log     func(msg string, keyvals ...interface{})
 	Msg     string
-	Keyvals []string
+	Keyvals []interface{}
 	Want    map[string]string
 }{
 	"no_pairs_debug": {
 		Log:     Debug,
 		Msg:     "test error",
-		Keyvals: []string{},
+		Keyvals: []interface{}{},
 		Want: map[string]string{
 			"msg":   "test error",
 			"date":  time.Time{}.UTC().Format(time.RFC3339),
-			"file":  "log_test.go:18",
+			"file":  "github.com/husio/x/log/log_test.go:18",
+			"func":  "log.TestLogger",
 			"level": "DEBUG",
 		},
 	},
 	"with_pairs_debug": {
 		Log:     Debug,
 		Msg:     "test error",
-		Keyvals: []string{"key1", "val1", "key2", "val2", "key3"},
+		Keyvals: []interface{}{"key1", "val1", "key2", "val2", "key3"},
 		Want: map[string]string{
 			"msg":   "test error",
 			"date":  time.Time{}.UTC().Format(time.RFC3339),
-			"file":  "log_test.go:18",
+			"file":  "github.com/husio/x/log/log_test.go:18",
+			"func":  "log.TestLogger",
 			"level": "DEBUG",
 			"key1":  "val1",
 			"key2":  "val2",
 			"key3":  "",
 		},
 	},
+	"no_pairs_info": {
+		Log:     Info,
+		Msg:     "test info",
+		Keyvals: []interface{}{"key1", "val1"},
+		Want: map[string]string{
+			"msg":   "test info",
+			"date":  time.Time{}.UTC().Format(time.RFC3339),
+			"file":  "github.com/husio/x/log/log_test.go:18",
+			"func":  "log.TestLogger",
+			"level": "INFO",
+			"key1":  "val1",
+		},
+	},
+	"no_pairs_warn": {
+		Log:     Warn,
+		Msg:     "test warn",
+		Keyvals: []interface{}{},
+		Want: map[string]string{
+			"msg":   "test warn",
+			"date":  time.Time{}.UTC().Format(time.RFC3339),
+			"file":  "github.com/husio/x/log/log_test.go:18",
+			"func":  "log.TestLogger",
+			"level": "WARN",
+		},
+	},
 	"no_pairs_err": {
 		Log:     Error,
 		Msg:     "test error",
-		Keyvals: []string{},
+		Keyvals: []interface{}{},
 		Want: map[string]string{
 			"msg":   "test error",
 			"date":  time.Time{}.UTC().Format(time.RFC3339),
-			"file":  "log_test.go:18",
+			"file":  "github.com/husio/x/log/log_test.go:18",
+			"func":  "log.TestLogger",
 			"level": "ERROR",
 		},
 	},
 	"with_pairs_err": {
 		Log:     Error,
 		Msg:     "test error",
-		Keyvals: []string{"key1", "val1", "key2", "val2", "key3"},
+		Keyvals: []interface{}{"key1", "val1", "key2", "val2", "key3"},
 		Want: map[string]string{
 			"msg":   "test error",
 			"date":  time.Time{}.UTC().Format(time.RFC3339),
-			"file":  "log_test.go:18",
+			"file":  "github.com/husio/x/log/log_test.go:18",
+			"func":  "log.TestLogger",
 			"level": "ERROR",
 			"key1":  "val1",
 			"key2":  "val2",
@@ -97,9 +131,9 @@ func testWithTime(now time.Time) func() {
 }
 
 func catchLoggerOut() (func() []byte, func()) {
-	write := root.write
+	sink := root.sink
 	buf := &bytes.Buffer{}
-	root.write = json.NewEncoder(buf).Encode
+	root.sink = NewWriterSink(buf, JSON)
 
 	read := func() []byte {
 		b := buf.Bytes()
@@ -107,7 +141,7 @@ func catchLoggerOut() (func() []byte, func()) {
 		return b
 	}
 	close := func() {
-		root.write = write
+		root.sink = sink
 	}
 	return read, close
 }
@@ -0,0 +1,95 @@
+package log
+
+import (
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Logfmt encoder writes every entry as single line of space separated
+// key=value pairs, with date, level, msg, file and func keys first. Stack
+// trace, if present, is written last. Values are quoted only if necessary.
+var Logfmt Encoder = logfmtEncoder{}
+
+type logfmtEncoder struct{}
+
+func (logfmtEncoder) Encode(b []byte, e *Entry) []byte {
+	b = append(b, "date="...)
+	b = append(b, formatDate(e.Time)...)
+	b = append(b, " level="...)
+	b = append(b, e.Level.String()...)
+	b = append(b, " msg="...)
+	b = appendLogfmtString(b, e.Message)
+	b = append(b, " file="...)
+	b = appendLogfmtString(b, e.File)
+	if e.Function != "" {
+		b = append(b, " func="...)
+		b = appendLogfmtString(b, e.Function)
+	}
+	for _, f := range e.Fields {
+		b = append(b, ' ')
+		b = appendLogfmtKey(b, f.Key)
+		b = append(b, '=')
+		b = appendLogfmtValue(b, f)
+	}
+	if e.Stack != "" {
+		b = append(b, " stack="...)
+		b = appendLogfmtString(b, e.Stack)
+	}
+	return append(b, '\n')
+}
+
+// appendLogfmtKey append key with characters not allowed in keys replaced by
+// underscore.
+func appendLogfmtKey(b []byte, key string) []byte {
+	if key == "" {
+		return append(b, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+			b = append(b, '_')
+		} else {
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func appendLogfmtValue(b []byte, f Field) []byte {
+	switch f.kind {
+	case kindString:
+		return appendLogfmtString(b, f.str)
+	case kindError:
+		if f.any == nil {
+			return append(b, "null"...)
+		}
+		return appendLogfmtString(b, f.any.(error).Error())
+	case kindAny:
+		return appendLogfmtString(b, string(appendText(nil, f)))
+	default:
+		// scalar values never require quoting
+		return appendText(b, f)
+	}
+}
+
+// appendLogfmtString append text value, quoted if necessary.
+func appendLogfmtString(b []byte, s string) []byte {
+	if needsQuote(s) {
+		return strconv.AppendQuote(b, s)
+	}
+	return append(b, s...)
+}
+
+// needsQuote return true if text is empty or contains white space, equal
+// sign, quote, non printable character or invalid UTF-8.
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
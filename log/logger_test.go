@@ -0,0 +1,52 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestLoggerWith(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, nil)
+	child := l.With("request", "123", "user")
+	child.Info("first", "user", "bob")
+	l.Info("second")
+
+	dec := json.NewDecoder(&buf)
+	var first, second map[string]string
+	if err := dec.Decode(&first); err != nil {
+		t.Fatalf("cannot decode: %s", err)
+	}
+	if first["request"] != "123" || first["user"] != "bob" || first["msg"] != "first" {
+		t.Errorf("invalid message: %v", first)
+	}
+	if first["file"] != "github.com/husio/x/log/logger_test.go:15" || first["func"] != "log.TestLoggerWith" {
+		t.Errorf("invalid location: %q %q", first["file"], first["func"])
+	}
+	if err := dec.Decode(&second); err != nil {
+		t.Fatalf("cannot decode: %s", err)
+	}
+	if _, ok := second["request"]; ok {
+		t.Errorf("parent must not have child fields: %v", second)
+	}
+
+	child.SetLevel(LevelError)
+	l.Warn("ignored")
+	if buf.Len() != 0 {
+		t.Errorf("want threshold shared with child, got %q", buf.String())
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if l := FromContext(context.Background()); l != Default() {
+		t.Error("want default logger")
+	}
+	l := New(&bytes.Buffer{}, nil).With("a", "b")
+	ctx := WithLogger(context.Background(), l)
+	if FromContext(ctx) != l {
+		t.Error("want context logger")
+	}
+}
@@ -0,0 +1,213 @@
+// Package logtest provides helpers for testing code that is logging.
+//
+// Recorder captures entries written by the logger, so that tests can make
+// assertions about them instead of parsing the output:
+//
+//	rec := logtest.Install(t)
+//
+//	HandleLogin(w, r)
+//	rec.AssertLogged(log.LevelError, "cannot get user", "provider", "github")
+package logtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/log"
+)
+
+// Recorder is a log sink that is capturing all written entries.
+type Recorder struct {
+	t      testing.TB
+	logger *log.Logger
+	// prev is the standard logger replaced by Install
+	prev *log.Logger
+
+	mu      sync.Mutex
+	entries []Entry
+	echo    bool
+	closed  bool
+}
+
+// Entry is captured log entry.
+type Entry struct {
+	log.Entry
+}
+
+// Get return value of the field with given key.
+func (e Entry) Get(key string) (interface{}, bool) {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value(), true
+		}
+	}
+	return nil, false
+}
+
+func (e Entry) String() string {
+	b := &log.Console{}
+	return strings.TrimSpace(string(b.Encode(nil, &e.Entry)))
+}
+
+// New return recorder capturing all messages written by its logger,
+// regardless of the thresholds.
+func New(t testing.TB) *Recorder {
+	rec := &Recorder{t: t}
+	rec.logger = log.New(nil, &log.Opts{Sinks: []log.Sink{rec}})
+	rec.logger.SetLevel(log.LevelDebug)
+	return rec
+}
+
+// Install return recorder, that is used as the standard logger until the
+// recorder is closed. Recorder is closed when the test finishes.
+//
+// Standard logger is shared by all tests, so Install must not be used by
+// tests running in parallel.
+func Install(t testing.TB) *Recorder {
+	rec := New(t)
+	rec.prev = log.Default()
+	log.SetDefault(rec.logger)
+	t.Cleanup(func() { rec.Close() })
+	return rec
+}
+
+// Logger return logger writing to the recorder.
+func (rec *Recorder) Logger() *log.Logger {
+	return rec.logger
+}
+
+// Context return context carrying logger writing to the recorder.
+func (rec *Recorder) Context(ctx context.Context) context.Context {
+	return log.WithLogger(ctx, rec.logger)
+}
+
+// Echo enables writing every captured entry to the test log, so that it is
+// visible when test fails or in verbose mode.
+func (rec *Recorder) Echo() *Recorder {
+	rec.mu.Lock()
+	rec.echo = true
+	rec.mu.Unlock()
+	return rec
+}
+
+// Close stop capturing entries and restore the standard logger, if it was
+// replaced.
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.closed {
+		return nil
+	}
+	rec.closed = true
+	if rec.prev != nil {
+		log.SetDefault(rec.prev)
+	}
+	return nil
+}
+
+// Write capture entry. It implements log.Sink interface.
+func (rec *Recorder) Write(e *log.Entry) error {
+	c := Entry{Entry: *e}
+	c.Fields = make([]log.Field, len(e.Fields))
+	copy(c.Fields, e.Fields)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.closed {
+		return log.ErrClosed
+	}
+	rec.entries = append(rec.entries, c)
+	if rec.echo {
+		rec.t.Log(c.String())
+	}
+	return nil
+}
+
+// Flush implements log.Sink interface.
+func (rec *Recorder) Flush() error {
+	return nil
+}
+
+// Entries return all captured entries.
+func (rec *Recorder) Entries() []Entry {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	entries := make([]Entry, len(rec.entries))
+	copy(entries, rec.entries)
+	return entries
+}
+
+// Reset remove all captured entries.
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	rec.entries = nil
+	rec.mu.Unlock()
+}
+
+// Find return all entries of given level and message, containing all given
+// key-value pairs. Values are compared using their text representation, so
+// that for example int and int64 values are equal.
+func (rec *Recorder) Find(level log.Level, msg string, keyvals ...interface{}) []Entry {
+	var found []Entry
+	for _, e := range rec.Entries() {
+		if e.Level == level && e.Message == msg && matches(e, keyvals) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func matches(e Entry, keyvals []interface{}) bool {
+	for i := 0; i < len(keyvals); i += 2 {
+		value, ok := e.Get(fmt.Sprint(keyvals[i]))
+		if !ok {
+			return false
+		}
+		var want interface{}
+		if i+1 < len(keyvals) {
+			want = keyvals[i+1]
+		}
+		if fmt.Sprint(value) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertLogged fail the test if no entry of given level and message,
+// containing all given key-value pairs, was captured.
+func (rec *Recorder) AssertLogged(level log.Level, msg string, keyvals ...interface{}) {
+	rec.t.Helper()
+	if len(rec.Find(level, msg, keyvals...)) != 0 {
+		return
+	}
+	rec.t.Errorf("no %s %q entry with %v logged\n%s", level, msg, keyvals, rec.dump())
+}
+
+// AssertNotLogged fail the test if any entry of given level and message was
+// captured.
+func (rec *Recorder) AssertNotLogged(level log.Level, msg string) {
+	rec.t.Helper()
+	if len(rec.Find(level, msg)) == 0 {
+		return
+	}
+	rec.t.Errorf("unexpected %s %q entry logged\n%s", level, msg, rec.dump())
+}
+
+// dump return description of all captured entries.
+func (rec *Recorder) dump() string {
+	entries := rec.Entries()
+	if len(entries) == 0 {
+		return "nothing was logged"
+	}
+	lines := make([]string, 0, len(entries)+1)
+	lines = append(lines, "logged:")
+	for _, e := range entries {
+		lines = append(lines, "\t"+e.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,86 @@
+package logtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/internal/testutil"
+	"github.com/husio/x/log"
+)
+
+func handler(ctx context.Context, id int) {
+	l := log.FromContext(ctx).With("id", id)
+	l.Debug("loading")
+	l.Error("cannot load", log.Err(errors.New("db down")))
+}
+
+func TestRecorder(t *testing.T) {
+	rec := New(t)
+	handler(rec.Context(context.Background()), 42)
+
+	rec.AssertLogged(log.LevelDebug, "loading")
+	rec.AssertLogged(log.LevelError, "cannot load", "id", 42, "error", "db down")
+	rec.AssertNotLogged(log.LevelWarn, "loading")
+
+	entries := rec.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("want 2 entries, got %d", len(entries))
+	}
+	if v, ok := entries[1].Get("id"); !ok || v != int64(42) {
+		t.Errorf("want 42, got %v", v)
+	}
+	if !strings.HasPrefix(entries[1].File, "github.com/husio/x/log/logtest/logtest_test.go:") {
+		t.Errorf("invalid file: %q", entries[1].File)
+	}
+
+	rec.Reset()
+	if n := len(rec.Entries()); n != 0 {
+		t.Errorf("want no entries, got %d", n)
+	}
+}
+
+func TestRecorderFailures(t *testing.T) {
+	rt := &testutil.RecordingT{TB: t}
+	rec := New(rt)
+	handler(rec.Context(context.Background()), 1)
+
+	rec.AssertLogged(log.LevelError, "cannot load", "id", 2)
+	rec.AssertLogged(log.LevelInfo, "cannot load")
+	rec.AssertLogged(log.LevelError, "cannot load", "missing", "")
+	rec.AssertNotLogged(log.LevelDebug, "loading")
+	errs := rt.Errors()
+	if len(errs) != 4 {
+		t.Fatalf("want 4 failures, got %d: %q", len(errs), errs)
+	}
+	if !strings.Contains(errs[0], "cannot load") || !strings.Contains(errs[0], "id=1") {
+		t.Errorf("want captured entries in failure, got %q", errs[0])
+	}
+}
+
+func TestInstall(t *testing.T) {
+	prev := log.Default()
+	rec := Install(t).Echo()
+	log.Warn("hello", "n", 1)
+	rec.Close()
+
+	rec.AssertLogged(log.LevelWarn, "hello", "n", 1)
+	if log.Default() != prev {
+		t.Error("want default logger restored")
+	}
+}
+
+func TestInstallCleanup(t *testing.T) {
+	prev := log.Default()
+	t.Run("install", func(t *testing.T) {
+		Install(t)
+		if log.Default() == prev {
+			t.Error("want recorder installed")
+		}
+	})
+	if log.Default() != prev {
+		t.Error("want default logger restored when test finished")
+	}
+}
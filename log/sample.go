@@ -0,0 +1,135 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// SampleOpts configures sampling of repeated messages. Messages are
+// identical if they have the same text and are logged at the same location.
+// Within every interval, first messages are written, then only every n-th.
+// At the end of the interval in which messages were suppressed, summary
+// entry is written for each of them.
+type SampleOpts struct {
+	// Interval is the time after which counters are reset. Defaults to 1
+	// second.
+	Interval time.Duration
+	// First is the number of identical messages written within interval
+	// before sampling starts. Defaults to 100.
+	First int
+	// Thereafter is the sampling rate, after first messages only every
+	// Thereafter message is written. Defaults to 100.
+	Thereafter int
+}
+
+type sampleKey struct {
+	msg  string
+	file string
+}
+
+type sampleCount struct {
+	level      Level
+	n          int
+	suppressed int
+}
+
+type sampler struct {
+	opts SampleOpts
+	// summary writes entry reporting suppressed messages
+	summary func(key sampleKey, level Level, suppressed int)
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[sampleKey]*sampleCount
+	// timer is running if any message was suppressed in current interval
+	timer *time.Timer
+	// gen is incremented with every flush, so that timer that fired late
+	// does not flush the next interval
+	gen int
+}
+
+func newSampler(o *SampleOpts, summary func(sampleKey, Level, int)) *sampler {
+	opts := *o
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.First <= 0 {
+		opts.First = 100
+	}
+	if opts.Thereafter <= 0 {
+		opts.Thereafter = 100
+	}
+	return &sampler{
+		opts:    opts,
+		summary: summary,
+		start:   currentTime(),
+		counts:  make(map[sampleKey]*sampleCount),
+	}
+}
+
+// allow return true if message should be written.
+func (s *sampler) allow(level Level, msg, file string) bool {
+	now := currentTime()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.start) >= s.opts.Interval {
+		s.flush()
+		s.start = now
+	}
+	key := sampleKey{msg: msg, file: file}
+	c, ok := s.counts[key]
+	if !ok {
+		c = &sampleCount{level: level}
+		s.counts[key] = c
+	}
+	c.n++
+	if c.n <= s.opts.First || (c.n-s.opts.First)%s.opts.Thereafter == 0 {
+		return true
+	}
+	c.suppressed++
+	if level > c.level {
+		c.level = level
+	}
+	if s.timer == nil {
+		gen := s.gen
+		s.timer = time.AfterFunc(s.start.Add(s.opts.Interval).Sub(now), func() {
+			s.tick(gen)
+		})
+	}
+	return false
+}
+
+func (s *sampler) tick(gen int) {
+	now := currentTime()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen != s.gen {
+		return
+	}
+	s.flush()
+	s.start = now
+}
+
+// Flush write summary of messages suppressed in current interval and reset
+// the counters.
+func (s *sampler) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
+func (s *sampler) flush() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	for key, c := range s.counts {
+		if c.suppressed > 0 {
+			s.summary(key, c.level, c.suppressed)
+		}
+	}
+	s.counts = make(map[sampleKey]*sampleCount)
+	s.gen++
+}
@@ -0,0 +1,93 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	defer testWithTime(now)()
+
+	var buf bytes.Buffer
+	l := New(&buf, &Opts{Sampling: &SampleOpts{Interval: time.Minute, First: 3, Thereafter: 5}})
+	for i := 0; i < 20; i++ {
+		l.Error("db down", "i", i)
+		l.Info("other")
+	}
+
+	var logged []int
+	var other int
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry struct {
+			Msg string
+			I   int
+		}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("cannot decode: %s", err)
+		}
+		if entry.Msg == "db down" {
+			logged = append(logged, entry.I)
+		} else {
+			other++
+		}
+	}
+	// first three, then every fifth
+	want := []int{0, 1, 2, 7, 12, 17}
+	if len(logged) != len(want) {
+		t.Fatalf("want %v, got %v", want, logged)
+	}
+	for i := range want {
+		if logged[i] != want[i] {
+			t.Fatalf("want %v, got %v", want, logged)
+		}
+	}
+	if other != 6 {
+		t.Errorf("want 6 other messages, got %d", other)
+	}
+
+	// next interval resets counters and writes summary
+	currentTime = func() time.Time { return now.Add(time.Minute) }
+	l.Error("db down", "i", 100)
+
+	var summaries []map[string]interface{}
+	for dec = json.NewDecoder(&buf); dec.More(); {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("cannot decode: %s", err)
+		}
+		summaries = append(summaries, entry)
+	}
+	if len(summaries) != 3 {
+		t.Fatalf("want 2 summaries and message, got %v", summaries)
+	}
+	for _, s := range summaries[:2] {
+		if s["msg"] != "messages suppressed" || s["suppressed"] != float64(14) {
+			t.Errorf("invalid summary: %v", s)
+		}
+	}
+	if summaries[2]["i"] != float64(100) {
+		t.Errorf("want message written, got %v", summaries[2])
+	}
+}
+
+func TestSamplingSummaryTimer(t *testing.T) {
+	sink := &memSink{}
+	l := New(nil, &Opts{
+		Sinks:    []Sink{sink},
+		Sampling: &SampleOpts{Interval: 20 * time.Millisecond, First: 1},
+	})
+	for i := 0; i < 2; i++ {
+		l.Warn("hot")
+	}
+	if got := sink.messages(); got != "hot" {
+		t.Fatalf("want single message, got %q", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := sink.messages(); got != "hot,messages suppressed" {
+		t.Errorf("want summary, got %q", got)
+	}
+}
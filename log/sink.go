@@ -0,0 +1,289 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Sink is the destination of log entries.
+type Sink interface {
+	// Write entry. Entry is valid only until the method returns and must be
+	// copied if it is retained.
+	Write(e *Entry) error
+	// Flush write all buffered entries.
+	Flush() error
+	// Close flush buffered entries and release resources. Sink cannot be
+	// used after closing.
+	Close() error
+}
+
+// NewWriterSink return sink writing entries serialized by given encoder to
+// the writer. Writer is flushed if it implements Flush() error method, but
+// it is never closed.
+func NewWriterSink(w io.Writer, enc Encoder) Sink {
+	return &writerSink{w: w, enc: enc}
+}
+
+type writerSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc Encoder
+}
+
+func (s *writerSink) Write(e *Entry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = s.enc.Encode(*buf, e)
+
+	s.mu.Lock()
+	_, err := s.w.Write(*buf)
+	s.mu.Unlock()
+	return err
+}
+
+func (s *writerSink) Flush() error {
+	f, ok := s.w.(interface {
+		Flush() error
+	})
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return f.Flush()
+}
+
+func (s *writerSink) Close() error {
+	return s.Flush()
+}
+
+// Tee return sink writing every entry to all given sinks. First error of any
+// sink is returned, but it does not stop writing to the remaining ones.
+func Tee(sinks ...Sink) Sink {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return tee(sinks)
+}
+
+type tee []Sink
+
+func (t tee) Write(e *Entry) error {
+	var first error
+	for _, s := range t {
+		if err := s.Write(e); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (t tee) Flush() error {
+	var first error
+	for _, s := range t {
+		if err := s.Flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (t tee) Close() error {
+	var first error
+	for _, s := range t {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// DropPolicy decides what happens when the queue of asynchronous sink is
+// full.
+type DropPolicy int
+
+const (
+	// DropNewest discards the entry being written.
+	DropNewest DropPolicy = iota
+	// DropOldest discards the oldest queued entry to make space for the
+	// one being written.
+	DropOldest
+	// Block waits until there is space in the queue.
+	Block
+)
+
+// AsyncOpts configures asynchronous sink.
+type AsyncOpts struct {
+	// QueueSize is the maximum number of entries waiting to be written.
+	// Defaults to 1024.
+	QueueSize int
+	// Policy decides what happens when queue is full. Defaults to
+	// DropNewest.
+	Policy DropPolicy
+	// OnError is called when wrapped sink fails to write an entry. Defaults
+	// to printing the error to stderr.
+	OnError func(error)
+}
+
+// Async is a sink that is writing entries to the wrapped sink in the
+// background, so that logging does not block on slow output.
+type Async struct {
+	sink  Sink
+	opts  AsyncOpts
+	queue chan *Entry
+	// flushes receive flush requests. They are not queued together with
+	// entries, so that they are never dropped.
+	flushes chan chan error
+	done    chan struct{}
+	dropped int64
+
+	// mu protects the queue from being used after closing
+	mu     sync.RWMutex
+	closed bool
+}
+
+// ErrClosed is returned when writing to closed sink.
+var ErrClosed = errors.New("sink closed")
+
+// NewAsync return sink writing entries to given sink in the background.
+// Close must be called to write all queued entries before exiting.
+func NewAsync(s Sink, o *AsyncOpts) *Async {
+	var opts AsyncOpts
+	if o != nil {
+		opts = *o
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.OnError == nil {
+		opts.OnError = printError
+	}
+	a := &Async{
+		sink:    s,
+		opts:    opts,
+		queue:   make(chan *Entry, opts.QueueSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *Async) run() {
+	defer close(a.done)
+	for {
+		select {
+		case e, ok := <-a.queue:
+			if !ok {
+				return
+			}
+			a.write(e)
+		case flush := <-a.flushes:
+			// entries queued before the flush request are written first.
+			// Queue might be emptied by DropOldest writes in the meantime.
+		drain:
+			for n := len(a.queue); n > 0; n-- {
+				select {
+				case e, ok := <-a.queue:
+					if !ok {
+						break drain
+					}
+					a.write(e)
+				default:
+					break drain
+				}
+			}
+			flush <- a.sink.Flush()
+		}
+	}
+}
+
+func (a *Async) write(e *Entry) {
+	if err := a.sink.Write(e); err != nil {
+		a.opts.OnError(err)
+	}
+}
+
+// Write queue copy of the entry. Entry is dropped if the queue is full,
+// unless Block policy is used.
+func (a *Async) Write(e *Entry) error {
+	item := copyEntry(e)
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrClosed
+	}
+
+	switch a.opts.Policy {
+	case Block:
+		a.queue <- item
+		return nil
+	case DropOldest:
+		for {
+			select {
+			case a.queue <- item:
+				return nil
+			default:
+			}
+			select {
+			case <-a.queue:
+				atomic.AddInt64(&a.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case a.queue <- item:
+		default:
+			atomic.AddInt64(&a.dropped, 1)
+		}
+		return nil
+	}
+}
+
+// Dropped return number of entries discarded because the queue was full.
+func (a *Async) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// Flush wait until all entries queued before the call are written and flush
+// the wrapped sink.
+func (a *Async) Flush() error {
+	flush := make(chan error, 1)
+
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return ErrClosed
+	}
+	a.flushes <- flush
+	a.mu.RUnlock()
+
+	return <-flush
+}
+
+// Close write all queued entries and close the wrapped sink.
+func (a *Async) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrClosed
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	return a.sink.Close()
+}
+
+// copyEntry return copy of the entry that can be retained.
+func copyEntry(e *Entry) *Entry {
+	c := *e
+	c.Fields = make([]Field, len(e.Fields))
+	copy(c.Fields, e.Fields)
+	return &c
+}
@@ -0,0 +1,166 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memSink is collecting messages of written entries.
+type memSink struct {
+	mu      sync.Mutex
+	msgs    []string
+	flushed int
+	closed  bool
+	err     error
+	// wait, if set, blocks writing until closed
+	wait chan struct{}
+}
+
+func (s *memSink) Write(e *Entry) error {
+	if s.wait != nil {
+		<-s.wait
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, e.Message)
+	return s.err
+}
+
+func (s *memSink) Flush() error {
+	s.mu.Lock()
+	s.flushed++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memSink) messages() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.msgs, ",")
+}
+
+func TestLoggerSinks(t *testing.T) {
+	var buf bytes.Buffer
+	failing := &memSink{err: errors.New("broken")}
+	other := &memSink{}
+	var errs []error
+	l := New(&buf, &Opts{
+		Sinks:   []Sink{failing, other},
+		OnError: func(err error) { errs = append(errs, err) },
+	})
+
+	l.Info("a")
+	l.With("k", "v").Info("b")
+	if got := other.messages(); got != "a,b" {
+		t.Errorf("want a,b, got %q", got)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("want 2 lines, got %d", n)
+	}
+	if len(errs) != 2 {
+		t.Errorf("want 2 errors, got %v", errs)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("cannot close: %s", err)
+	}
+	if !other.closed || !failing.closed {
+		t.Error("want all sinks closed")
+	}
+}
+
+func TestAsync(t *testing.T) {
+	sink := &memSink{}
+	a := NewAsync(sink, nil)
+	l := New(nil, &Opts{Sinks: []Sink{a}})
+	for _, msg := range []string{"a", "b", "c"} {
+		l.Info(msg)
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatalf("cannot flush: %s", err)
+	}
+	if got := sink.messages(); got != "a,b,c" {
+		t.Errorf("want a,b,c, got %q", got)
+	}
+	if sink.flushed != 1 {
+		t.Errorf("want 1 flush, got %d", sink.flushed)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("cannot close: %s", err)
+	}
+	if !sink.closed {
+		t.Error("want sink closed")
+	}
+	if err := a.Write(&Entry{}); err != ErrClosed {
+		t.Errorf("want ErrClosed, got %v", err)
+	}
+}
+
+func TestAsyncDropPolicy(t *testing.T) {
+	cases := map[DropPolicy]string{
+		DropNewest: "a,b,c",
+		DropOldest: "a,d,e",
+	}
+	for policy, want := range cases {
+		sink := &memSink{wait: make(chan struct{})}
+		a := NewAsync(sink, &AsyncOpts{QueueSize: 2, Policy: policy})
+		a.Write(&Entry{Message: "a"})
+		// wait until the first entry is taken from the queue
+		for len(a.queue) != 0 {
+		}
+		for _, msg := range []string{"b", "c", "d", "e"} {
+			a.Write(&Entry{Message: msg})
+		}
+		close(sink.wait)
+		a.Close()
+
+		if got := sink.messages(); got != want {
+			t.Errorf("%d: want %s, got %s", policy, want, got)
+		}
+		if n := a.Dropped(); n != 2 {
+			t.Errorf("%d: want 2 dropped, got %d", policy, n)
+		}
+	}
+}
+
+func TestAsyncFlushDropOldest(t *testing.T) {
+	sink := &memSink{wait: make(chan struct{})}
+	a := NewAsync(sink, &AsyncOpts{QueueSize: 2, Policy: DropOldest})
+	defer a.Close()
+	a.Write(&Entry{Message: "a"})
+	for len(a.queue) != 0 {
+	}
+	a.Write(&Entry{Message: "b"})
+	a.Write(&Entry{Message: "c"})
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- a.Flush() }()
+	// full queue is rotated, while the flush is waiting
+	for i := 0; i < 10; i++ {
+		a.Write(&Entry{Message: "x"})
+	}
+	close(sink.wait)
+
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatalf("cannot flush: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flush blocked")
+	}
+	if sink.flushed != 1 {
+		t.Errorf("want wrapped sink flushed, got %d", sink.flushed)
+	}
+}
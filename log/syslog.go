@@ -0,0 +1,253 @@
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyslogOpts configures syslog sink.
+type SyslogOpts struct {
+	// Facility is the syslog facility code. Defaults to 1 (user-level
+	// messages).
+	Facility int
+	// Hostname defaults to the name reported by the kernel.
+	Hostname string
+	// AppName defaults to the program name.
+	AppName string
+	// SDID is the ID of the structured data element containing message
+	// fields. Defaults to "fields@32473".
+	SDID string
+	// Timeout limits writing of a single message. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Syslog is a sink sending entries to syslog server using RFC 5424 format.
+// Message fields and location are sent as parameters of a single structured
+// data element.
+type Syslog struct {
+	network string
+	addr    string
+	opts    SyslogOpts
+	pid     string
+
+	mu sync.Mutex
+	cn net.Conn
+}
+
+// NewSyslog return sink connected to syslog server at given address. Network
+// is one of "unixgram", "unix", "udp" or "tcp". If network is empty, local
+// syslog server is used. Stream connections are framed using octet counting.
+func NewSyslog(network, addr string, o *SyslogOpts) (*Syslog, error) {
+	var opts SyslogOpts
+	if o != nil {
+		opts = *o
+	}
+	if opts.Facility == 0 {
+		opts.Facility = 1
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.SDID == "" {
+		opts.SDID = "fields@32473"
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	s := &Syslog{
+		network: network,
+		addr:    addr,
+		opts:    opts,
+		pid:     strconv.Itoa(os.Getpid()),
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var errNoSyslog = errors.New("cannot connect to local syslog server")
+
+func (s *Syslog) connect() error {
+	if s.cn != nil {
+		s.cn.Close()
+		s.cn = nil
+	}
+	if s.network != "" {
+		cn, err := net.DialTimeout(s.network, s.addr, s.opts.Timeout)
+		if err != nil {
+			return err
+		}
+		s.cn = cn
+		return nil
+	}
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		if cn, err := net.DialTimeout("unixgram", path, s.opts.Timeout); err == nil {
+			s.network, s.addr, s.cn = "unixgram", path, cn
+			return nil
+		}
+	}
+	return errNoSyslog
+}
+
+// severity return syslog severity of given level.
+func severity(l Level) int {
+	switch l {
+	case LevelError:
+		return 3
+	case LevelWarn:
+		return 4
+	case LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+func (s *Syslog) Write(e *Entry) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = s.encode(*buf, e)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cn == nil {
+		return ErrClosed
+	}
+	err := s.write(*buf)
+	if err != nil {
+		// connection might have been closed by the server
+		if s.connect() == nil {
+			err = s.write(*buf)
+		}
+	}
+	return err
+}
+
+func (s *Syslog) write(msg []byte) error {
+	s.cn.SetWriteDeadline(time.Now().Add(s.opts.Timeout))
+	if s.network == "tcp" || s.network == "unix" {
+		var prefix [24]byte
+		p := strconv.AppendInt(prefix[:0], int64(len(msg)), 10)
+		p = append(p, ' ')
+		bufs := net.Buffers{p, msg}
+		_, err := bufs.WriteTo(s.cn)
+		return err
+	}
+	_, err := s.cn.Write(msg)
+	return err
+}
+
+// encode append RFC 5424 formatted entry.
+func (s *Syslog) encode(b []byte, e *Entry) []byte {
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(s.opts.Facility*8+severity(e.Level)), 10)
+	b = append(b, ">1 "...)
+	b = e.Time.UTC().AppendFormat(b, "2006-01-02T15:04:05.000000Z07:00")
+	b = append(b, ' ')
+	b = appendSyslogHeader(b, s.opts.Hostname, 255)
+	b = append(b, ' ')
+	b = appendSyslogHeader(b, s.opts.AppName, 48)
+	b = append(b, ' ')
+	b = append(b, s.pid...)
+	b = append(b, " - ["...)
+	b = append(b, s.opts.SDID...)
+	b = append(b, ` file="`...)
+	b = appendSDValue(b, e.File)
+	b = append(b, '"')
+	if e.Function != "" {
+		b = append(b, ` func="`...)
+		b = appendSDValue(b, e.Function)
+		b = append(b, '"')
+	}
+	for _, f := range e.Fields {
+		b = append(b, ' ')
+		b = appendSDName(b, f.Key)
+		b = append(b, `="`...)
+		b = appendSDValue(b, string(appendText(nil, f)))
+		b = append(b, '"')
+	}
+	if e.Stack != "" {
+		b = append(b, ` stack="`...)
+		b = appendSDValue(b, e.Stack)
+		b = append(b, '"')
+	}
+	b = append(b, "] "...)
+	return append(b, e.Message...)
+}
+
+// appendSyslogHeader append header value, that must be printable ASCII
+// without spaces and is limited in length. Empty value is written as "-".
+func appendSyslogHeader(b []byte, s string, max int) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			b = append(b, c)
+		} else {
+			b = append(b, '_')
+		}
+	}
+	return b
+}
+
+// appendSDName append structured data parameter name, that must be at most
+// 32 characters of printable ASCII except '=', ' ', ']' and '"'.
+func appendSDName(b []byte, name string) []byte {
+	if name == "" {
+		return append(b, '_')
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c <= ' ', c >= 0x7f, c == '=', c == ']', c == '"':
+			b = append(b, '_')
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+// appendSDValue append structured data parameter value, with '"', '\' and
+// ']' escaped.
+func appendSDValue(b []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			b = append(b, '\\', c)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func (s *Syslog) Flush() error {
+	return nil
+}
+
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cn == nil {
+		return ErrClosed
+	}
+	err := s.cn.Close()
+	s.cn = nil
+	return err
+}
@@ -0,0 +1,135 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var syslogEntry = &Entry{
+	Time:    time.Date(2016, 1, 2, 3, 4, 5, 6000, time.UTC),
+	Level:   LevelWarn,
+	Message: "disk almost full",
+	File:    "main.go:12",
+	Fields:  []Field{String("path", `/var/"x"]`), Int("free", 3), String("bad key=", "v")},
+}
+
+func syslogWant() string {
+	return `<12>1 2016-01-02T03:04:05.000006Z host app ` + strconv.Itoa(os.Getpid()) +
+		` - [fields@32473 file="main.go:12" path="/var/\"x\"\]" free="3" bad_key_="v"] disk almost full`
+}
+
+func TestSyslogUDP(t *testing.T) {
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer ln.Close()
+
+	s, err := NewSyslog("udp", ln.LocalAddr().String(), &SyslogOpts{Hostname: "host", AppName: "app"})
+	if err != nil {
+		t.Fatalf("cannot connect: %s", err)
+	}
+	defer s.Close()
+
+	if err := s.Write(syslogEntry); err != nil {
+		t.Fatalf("cannot write: %s", err)
+	}
+	buf := make([]byte, 1024)
+	ln.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := ln.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("cannot read: %s", err)
+	}
+	if got, want := string(buf[:n]), syslogWant(); got != want {
+		t.Errorf("invalid message\nwant: %s\n got: %s", want, got)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 2)
+	go func() {
+		cn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer cn.Close()
+		rd := bufio.NewReader(cn)
+		for {
+			size, err := rd.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(rd, msg); err != nil {
+				return
+			}
+			msgs <- string(msg)
+		}
+	}()
+
+	s, err := NewSyslog("tcp", ln.Addr().String(), &SyslogOpts{Hostname: "host", AppName: "app", Facility: 16})
+	if err != nil {
+		t.Fatalf("cannot connect: %s", err)
+	}
+	defer s.Close()
+
+	l := New(nil, &Opts{Sinks: []Sink{s}})
+	l.Error("first")
+	l.Debug("second")
+	for _, want := range []string{"<131>1 ", "<135>1 "} {
+		select {
+		case msg := <-msgs:
+			if !strings.HasPrefix(msg, want) {
+				t.Errorf("want %q prefix, got %q", want, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("cannot create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("cannot listen: %s", err)
+	}
+	defer ln.Close()
+
+	s, err := NewSyslog("unixgram", path, &SyslogOpts{Hostname: "host", AppName: "app"})
+	if err != nil {
+		t.Fatalf("cannot connect: %s", err)
+	}
+	defer s.Close()
+	if err := s.Write(syslogEntry); err != nil {
+		t.Fatalf("cannot write: %s", err)
+	}
+	buf := make([]byte, 1024)
+	ln.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := ln.Read(buf)
+	if err != nil {
+		t.Fatalf("cannot read: %s", err)
+	}
+	if got, want := string(buf[:n]), syslogWant(); got != want {
+		t.Errorf("invalid message\nwant: %s\n got: %s", want, got)
+	}
+}
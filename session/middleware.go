@@ -0,0 +1,181 @@
+package session
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/web"
+)
+
+// Store is the persistence layer for sessions.
+type Store interface {
+	// Load return session identified by given cookie value. ErrNotFound is
+	// returned if session does not exist.
+	Load(ctx context.Context, key string) (*Session, error)
+	// Save persist given session and return cookie value that identifies
+	// it. Store should not keep session after its expiration time.
+	Save(ctx context.Context, s *Session) (string, error)
+	// Delete remove session with given identifier.
+	Delete(ctx context.Context, id string) error
+}
+
+// Opts defines session cookie and expiration settings.
+type Opts struct {
+	// CookieName defaults to "s".
+	CookieName string
+	// CookiePath defaults to "/".
+	CookiePath string
+	// Secure set the secure flag of the cookie.
+	Secure bool
+	// IdleTimeout is the time after which session expires if not used.
+	// Defaults to 30 minutes.
+	IdleTimeout time.Duration
+	// MaxAge is the absolute session lifetime, counted from its creation.
+	// Defaults to 7 days.
+	MaxAge time.Duration
+}
+
+// WithSessions return handler that provides session for wrapped handler. Use
+// Get to access session from within the handler.
+//
+// Session is saved before the first byte of the response is written.
+func WithSessions(store Store, o *Opts, fn web.HandlerFunc) web.HandlerFunc {
+	if o == nil {
+		o = &Opts{}
+	}
+	opts := *o
+	if opts.CookieName == "" {
+		opts.CookieName = "s"
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = 30 * time.Minute
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = 7 * 24 * time.Hour
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		now := currentTime()
+		s := loadSession(ctx, store, &opts, r, now)
+		sw := &sessionWriter{
+			ResponseWriter: w,
+			commit: func(w http.ResponseWriter) {
+				saveSession(ctx, store, &opts, w, s, now)
+			},
+		}
+		fn(WithSession(ctx, s), sw, r)
+		sw.save()
+	}
+}
+
+func loadSession(ctx context.Context, store Store, o *Opts, r *http.Request, now time.Time) *Session {
+	c, err := r.Cookie(o.CookieName)
+	if err != nil || c.Value == "" {
+		return newSession(now)
+	}
+	s, err := store.Load(ctx, c.Value)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Printf("cannot load session: %s", err)
+		}
+		return newSession(now)
+	}
+
+	if now.After(s.created.Add(o.MaxAge)) || now.After(s.accessed.Add(o.IdleTimeout)) {
+		if err := store.Delete(ctx, s.id); err != nil {
+			log.Printf("cannot delete expired session: %s", err)
+		}
+		return newSession(now)
+	}
+
+	// avoid writing session on every request only to update access time
+	if now.Sub(s.accessed) > o.IdleTimeout/touchFraction {
+		s.accessed = now
+		s.modified = true
+	}
+	return s
+}
+
+// touchFraction defines how often, as a fraction of idle timeout, session
+// access time is updated.
+const touchFraction = 10
+
+func saveSession(ctx context.Context, store Store, o *Opts, w http.ResponseWriter, s *Session, now time.Time) {
+	for _, id := range s.rotated {
+		if err := store.Delete(ctx, id); err != nil {
+			log.Printf("cannot delete rotated session: %s", err)
+		}
+	}
+	s.rotated = nil
+
+	if s.destroyed {
+		if err := store.Delete(ctx, s.id); err != nil {
+			log.Printf("cannot delete session: %s", err)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     o.CookieName,
+			Path:     o.CookiePath,
+			Value:    "",
+			MaxAge:   -1,
+			Secure:   o.Secure,
+			HttpOnly: true,
+		})
+		return
+	}
+
+	if !s.modified {
+		return
+	}
+
+	s.expires = s.created.Add(o.MaxAge)
+	if idle := s.accessed.Add(o.IdleTimeout); idle.Before(s.expires) {
+		s.expires = idle
+	}
+	key, err := store.Save(ctx, s)
+	if err != nil {
+		log.Printf("cannot save session: %s", err)
+		return
+	}
+	s.modified = false
+	http.SetCookie(w, &http.Cookie{
+		Name:     o.CookieName,
+		Path:     o.CookiePath,
+		Value:    key,
+		Expires:  s.created.Add(o.MaxAge),
+		Secure:   o.Secure,
+		HttpOnly: true,
+	})
+}
+
+// sessionWriter call commit function right before anything is written.
+type sessionWriter struct {
+	http.ResponseWriter
+	commit func(http.ResponseWriter)
+	saved  bool
+}
+
+func (w *sessionWriter) save() {
+	if !w.saved {
+		w.saved = true
+		w.commit(w.ResponseWriter)
+	}
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.save()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.save()
+	return w.ResponseWriter.Write(b)
+}
+
+// we want to mock current time in tests
+var currentTime = time.Now
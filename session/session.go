@@ -0,0 +1,189 @@
+// Package session implements server side, per client state storage.
+//
+// Session is loaded by the middleware before request is handled and stored
+// back, together with the cookie identifying it, right before the response is
+// written. Session data can be kept in PostgreSQL, cache or, when using signed
+// cookies, entirely on the client side.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Session holds key-value state of a single client.
+type Session struct {
+	id       string
+	created  time.Time
+	accessed time.Time
+	expires  time.Time
+	values   map[string]json.RawMessage
+	flashes  []Flash
+
+	modified  bool
+	destroyed bool
+	// rotated holds all identifiers the session was using before key
+	// rotation, that must be removed from the store
+	rotated []string
+}
+
+// Flash is a message that is displayed to the user only once.
+type Flash struct {
+	Kind string
+	Text string
+}
+
+func newSession(now time.Time) *Session {
+	return &Session{
+		id:       newID(),
+		created:  now,
+		accessed: now,
+		values:   make(map[string]json.RawMessage),
+	}
+}
+
+// ID return unique session identifier.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Created return session creation time.
+func (s *Session) Created() time.Time {
+	return s.created
+}
+
+// Expires return time after which session is no longer valid.
+func (s *Session) Expires() time.Time {
+	return s.expires
+}
+
+// Get load value stored under given key into dest. ErrNotFound is returned if
+// value does not exist.
+func (s *Session) Get(key string, dest interface{}) error {
+	raw, ok := s.values[key]
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// Set store value under given key. Value must be JSON serializable.
+func (s *Session) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot serialize: %s", err)
+	}
+	s.values[key] = raw
+	s.modified = true
+	return nil
+}
+
+// Del remove value stored under given key.
+func (s *Session) Del(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// AddFlash add message that will be returned by next Flashes call.
+func (s *Session) AddFlash(kind, text string) {
+	s.flashes = append(s.flashes, Flash{Kind: kind, Text: text})
+	s.modified = true
+}
+
+// Flashes return all flash messages and remove them from the session.
+func (s *Session) Flashes() []Flash {
+	flashes := s.flashes
+	if len(flashes) != 0 {
+		s.flashes = nil
+		s.modified = true
+	}
+	return flashes
+}
+
+// Rotate change session identifier, keeping all values. Call it whenever
+// privilege level changes, for example after login, to prevent session
+// fixation.
+func (s *Session) Rotate() {
+	s.rotated = append(s.rotated, s.id)
+	s.id = newID()
+	s.modified = true
+}
+
+// Destroy remove session from the store and expire the client cookie.
+func (s *Session) Destroy() {
+	s.destroyed = true
+}
+
+// record is the serialized form of the session.
+type record struct {
+	ID       string                     `json:"id"`
+	Created  time.Time                  `json:"created"`
+	Accessed time.Time                  `json:"accessed"`
+	Values   map[string]json.RawMessage `json:"values,omitempty"`
+	Flashes  []Flash                    `json:"flashes,omitempty"`
+	// Expires is using JWT claim name, so that signed cookie expiration is
+	// validated when decoding.
+	Expires int64 `json:"exp"`
+}
+
+func (s *Session) MarshalJSON() ([]byte, error) {
+	return json.Marshal(record{
+		ID:       s.id,
+		Created:  s.created,
+		Accessed: s.accessed,
+		Values:   s.values,
+		Flashes:  s.flashes,
+		Expires:  s.expires.Unix(),
+	})
+}
+
+func (s *Session) UnmarshalJSON(b []byte) error {
+	var r record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return err
+	}
+	s.id = r.ID
+	s.created = r.Created
+	s.accessed = r.Accessed
+	s.expires = time.Unix(r.Expires, 0)
+	s.values = r.Values
+	if s.values == nil {
+		s.values = make(map[string]json.RawMessage)
+	}
+	s.flashes = r.Flashes
+	return nil
+}
+
+// Get return session carried by given context.
+func Get(ctx context.Context) *Session {
+	s := ctx.Value("session")
+	if s == nil {
+		panic("session not present in context")
+	}
+	return s.(*Session)
+}
+
+// WithSession return context carrying given session.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, "session", s)
+}
+
+// ErrNotFound is returned when requested entity does not exist.
+var ErrNotFound = errors.New("not found")
+
+func newID() string {
+	b := make([]byte, 30)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("cannot read random value: %s", err))
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b))
+}
@@ -0,0 +1,179 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+	"github.com/husio/x/stamp"
+)
+
+func TestSessionValues(t *testing.T) {
+	s := newSession(time.Now())
+
+	var n int
+	if err := s.Get("n", &n); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if err := s.Set("n", 42); err != nil {
+		t.Fatalf("cannot set: %s", err)
+	}
+	if err := s.Get("n", &n); err != nil || n != 42 {
+		t.Fatalf("want 42, got %d, %v", n, err)
+	}
+	s.Del("n")
+	if err := s.Get("n", &n); err != ErrNotFound {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+
+	s.AddFlash("info", "first")
+	s.AddFlash("error", "second")
+	if f := s.Flashes(); len(f) != 2 || f[0].Text != "first" || f[1].Kind != "error" {
+		t.Errorf("invalid flashes: %+v", f)
+	}
+	if f := s.Flashes(); len(f) != 0 {
+		t.Errorf("flashes must be removed once read: %+v", f)
+	}
+}
+
+func TestStores(t *testing.T) {
+	var vault stamp.Vault
+	vault.AddSigner("key", stamp.NewHMAC256Signer([]byte("secret")), time.Hour)
+
+	ctx := context.Background()
+	ctx = cache.WithLocalCache(ctx, 100)
+	ctx = stamp.WithVault(ctx, &vault)
+
+	stores := map[string]Store{
+		"cache":  &CacheStore{},
+		"cookie": CookieStore{},
+	}
+	for name, store := range stores {
+		testStore(ctx, t, name, store)
+	}
+}
+
+func testStore(ctx context.Context, t *testing.T, name string, store Store) {
+	var ids []string
+	h := WithSessions(store, nil, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		s := Get(ctx)
+		ids = append(ids, s.ID())
+
+		var n int
+		if err := s.Get("n", &n); err != nil && err != ErrNotFound {
+			t.Fatalf("%s: cannot get: %s", name, err)
+		}
+		if err := s.Set("n", n+1); err != nil {
+			t.Fatalf("%s: cannot set: %s", name, err)
+		}
+		if r.URL.Path == "/login" {
+			s.Rotate()
+		}
+		if r.URL.Path == "/logout" {
+			s.Destroy()
+		}
+		fmt.Fprint(w, n+1)
+	})
+
+	var cookie *http.Cookie
+	call := func(path string) string {
+		r, _ := http.NewRequest("GET", path, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h(ctx, w, r)
+		resp := http.Response{Header: w.Header()}
+		if cs := resp.Cookies(); len(cs) == 1 {
+			cookie = cs[0]
+		}
+		return w.Body.String()
+	}
+
+	for i, want := range []string{"1", "2", "3"} {
+		if got := call("/"); got != want {
+			t.Errorf("%s: %d: want %s, got %s", name, i, want, got)
+		}
+	}
+	if ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Errorf("%s: session id changed: %v", name, ids)
+	}
+
+	if got := call("/login"); got != "4" {
+		t.Errorf("%s: want 4, got %s", name, got)
+	}
+	if got := call("/"); got != "5" {
+		t.Errorf("%s: values must survive rotation, got %s", name, got)
+	}
+	if ids[3] != ids[2] || ids[4] == ids[3] {
+		t.Errorf("%s: session id was not rotated: %v", name, ids)
+	}
+
+	call("/logout")
+	if cookie.MaxAge >= 0 {
+		t.Errorf("%s: logout must expire cookie: %+v", name, cookie)
+	}
+	cookie = nil
+	if got := call("/"); got != "1" {
+		t.Errorf("%s: want new session, got %s", name, got)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Now()
+	defer func() { currentTime = time.Now }()
+
+	ctx := cache.WithLocalCache(context.Background(), 100)
+	opts := &Opts{IdleTimeout: time.Minute, MaxAge: time.Hour}
+	h := WithSessions(&CacheStore{}, opts, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		s := Get(ctx)
+		var n int
+		s.Get("n", &n)
+		s.Set("n", n+1)
+		fmt.Fprint(w, n+1)
+	})
+
+	var cookie *http.Cookie
+	callAt := func(at time.Time) string {
+		currentTime = func() time.Time { return at }
+		r, _ := http.NewRequest("GET", "/", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h(ctx, w, r)
+		resp := http.Response{Header: w.Header()}
+		if cs := resp.Cookies(); len(cs) == 1 {
+			cookie = cs[0]
+		}
+		return w.Body.String()
+	}
+
+	if got := callAt(now); got != "1" {
+		t.Fatalf("want 1, got %s", got)
+	}
+	// keep using session within idle timeout
+	for i := 1; i < 5; i++ {
+		callAt(now.Add(time.Duration(i) * 50 * time.Second))
+	}
+	if got := callAt(now.Add(240 * time.Second)); got != "6" {
+		t.Errorf("want session to be kept alive, got %s", got)
+	}
+	if got := callAt(now.Add(10 * time.Minute)); got != "1" {
+		t.Errorf("want idle session to expire, got %s", got)
+	}
+
+	// absolute lifetime cannot be extended by activity
+	start := now.Add(10 * time.Minute)
+	for i := 1; i < 72; i++ {
+		callAt(start.Add(time.Duration(i) * 50 * time.Second))
+	}
+	if got := callAt(start.Add(time.Hour + time.Second)); got != "1" {
+		t.Errorf("want session to expire after max age, got %s", got)
+	}
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+)
+
+// CacheStore keep sessions in the cache carried by the context.
+//
+// Keep in mind that cache may drop entries at any time, which results in
+// client losing the session.
+type CacheStore struct {
+	// Prefix is prepended to the session id to build cache key. Defaults
+	// to "session:".
+	Prefix string
+}
+
+func (cs *CacheStore) key(id string) string {
+	if cs.Prefix == "" {
+		return "session:" + id
+	}
+	return cs.Prefix + id
+}
+
+func (cs *CacheStore) Load(ctx context.Context, key string) (*Session, error) {
+	var s Session
+	switch err := cache.Get(ctx).Get(cs.key(key), &s); err {
+	case nil:
+		return &s, nil
+	case cache.ErrNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+}
+
+func (cs *CacheStore) Save(ctx context.Context, s *Session) (string, error) {
+	ttl := s.Expires().Sub(currentTime())
+	if err := cache.Get(ctx).PutTTL(cs.key(s.ID()), s, ttl); err != nil {
+		return "", err
+	}
+	return s.ID(), nil
+}
+
+func (cs *CacheStore) Delete(ctx context.Context, id string) error {
+	return cache.Get(ctx).Del(cs.key(id))
+}
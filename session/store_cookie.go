@@ -0,0 +1,51 @@
+package session
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/stamp"
+)
+
+// CookieStore keep whole session in the client cookie, signed using vault
+// carried by the context. Adding new signer to the vault rotates the signing
+// key, while sessions signed with older keys remain valid as long as their
+// verifiers are present.
+//
+// Because session state is kept by the client, deleted or rotated sessions
+// cannot be revoked until they expire.
+type CookieStore struct{}
+
+func (CookieStore) Load(ctx context.Context, key string) (*Session, error) {
+	var s Session
+	switch err := stamp.GetVault(ctx).Decode(&s, []byte(key)); err {
+	case nil:
+		return &s, nil
+	case stamp.ErrExpired:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+}
+
+func (CookieStore) Save(ctx context.Context, s *Session) (string, error) {
+	token, err := stamp.GetVault(ctx).Encode(s)
+	if err != nil {
+		return "", err
+	}
+	if len(token) > maxCookieSize {
+		return "", ErrTooLarge
+	}
+	return string(token), nil
+}
+
+func (CookieStore) Delete(ctx context.Context, id string) error {
+	return nil
+}
+
+// maxCookieSize is the biggest value that browsers are guaranteed to accept.
+const maxCookieSize = 4000
+
+// ErrTooLarge is returned when session is too big to be stored.
+var ErrTooLarge = errors.New("session too large")
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/storage/pg"
+)
+
+// PgStore keep sessions in the PostgreSQL database carried by the context.
+// See Schema for required table definition.
+//
+// Expired sessions are not returned, but must be removed periodically, for
+// example using DeleteExpired.
+type PgStore struct{}
+
+func (PgStore) Load(ctx context.Context, key string) (*Session, error) {
+	var raw string
+	err := pg.DB(ctx).Get(&raw, `
+		SELECT data FROM web_sessions
+		WHERE key = $1 AND expires > now()
+		LIMIT 1
+	`, key)
+	if err := pg.CastErr(err); err != nil {
+		if err == pg.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return nil, fmt.Errorf("cannot deserialize: %s", err)
+	}
+	return &s, nil
+}
+
+func (PgStore) Save(ctx context.Context, s *Session) (string, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("cannot serialize: %s", err)
+	}
+	_, err = pg.DB(ctx).Exec(`
+		INSERT INTO web_sessions (key, data, expires)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET data = $2, expires = $3
+	`, s.ID(), string(raw), s.Expires())
+	if err != nil {
+		return "", pg.CastErr(err)
+	}
+	return s.ID(), nil
+}
+
+func (PgStore) Delete(ctx context.Context, id string) error {
+	_, err := pg.DB(ctx).Exec(`
+		DELETE FROM web_sessions WHERE key = $1
+	`, id)
+	return pg.CastErr(err)
+}
+
+// DeleteExpired remove all expired sessions from the database.
+func DeleteExpired(e pg.Execer) (int64, error) {
+	res, err := e.Exec(`
+		DELETE FROM web_sessions WHERE expires < now()
+	`)
+	if err != nil {
+		return 0, pg.CastErr(err)
+	}
+	return res.RowsAffected()
+}
+
+// Schema return SQL statements required by PgStore.
+func Schema() []string {
+	return strings.Split(schema, "---")
+}
+
+const schema = `
+
+CREATE TABLE IF NOT EXISTS web_sessions (
+    key         TEXT PRIMARY KEY,
+    data        TEXT NOT NULL,
+    expires     TIMESTAMPTZ NOT NULL
+);
+
+---
+
+CREATE INDEX IF NOT EXISTS web_sessions_expires_idx ON web_sessions (expires);
+
+`
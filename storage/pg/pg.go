@@ -2,12 +2,13 @@ package pg
 
 import (
 	"database/sql"
-	"errors"
 	"log"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"golang.org/x/net/context"
+
+	"github.com/husio/x/errors"
 )
 
 // Getter is generic interface for getting single entity
@@ -71,9 +72,11 @@ func CastErr(err error) error {
 	return err
 }
 
+// Errors returned by CastErr. They are of errors.NotFound and errors.Conflict
+// kind respectively.
 var (
-	ErrNotFound = errors.New("not found")
-	ErrConflict = errors.New("conflict")
+	ErrNotFound = errors.Sentinel(errors.NotFound, "not found")
+	ErrConflict = errors.Sentinel(errors.Conflict, "conflict")
 )
 
 // sqlxdb wraps sqlx.DB structure and provides custom function notations that
@@ -2,12 +2,13 @@ package sq
 
 import (
 	"database/sql"
-	"errors"
 	"log"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/mattn/go-sqlite3"
 	"golang.org/x/net/context"
+
+	"github.com/husio/x/errors"
 )
 
 // Getter is generic interface for getting single entity
@@ -76,9 +77,11 @@ func CastErr(err error) error {
 	return err
 }
 
+// Errors returned by CastErr. They are of errors.NotFound and errors.Conflict
+// kind respectively.
 var (
-	ErrNotFound = errors.New("not found")
-	ErrConflict = errors.New("conflict")
+	ErrNotFound = errors.Sentinel(errors.NotFound, "not found")
+	ErrConflict = errors.Sentinel(errors.Conflict, "conflict")
 )
 
 // sqlxdb wraps sqlx.DB structure and provides custom function notations that
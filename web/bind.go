@@ -0,0 +1,177 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/husio/x/envconf"
+)
+
+// BindForm parse request form and assign its values to the fields of given
+// structure. See BindValues for mapping rules.
+func BindForm(r *http.Request, dest interface{}) error {
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse form: %s", err)
+	}
+	return BindValues(r.Form, dest)
+}
+
+// BindQuery assign request query string values to the fields of given
+// structure. See BindValues for mapping rules.
+func BindQuery(r *http.Request, dest interface{}) error {
+	return BindValues(r.URL.Query(), dest)
+}
+
+// BindValues assign values to the fields of structure pointed by dest.
+//
+// Field is matched using name defined by "form" tag or, if not provided, by
+// snake case version of field name. Use "-" as the name to skip the field.
+// Nested structures are bind using dot separated prefix, for example field
+// Street of nested Address structure is matched by "address.street" name.
+//
+// Values are converted using the same rules as envconf.Load does. Slices are
+// filled with all values provided for the name, nil pointers are allocated
+// only if any value for them was provided.
+//
+// If any of the values cannot be converted, BindErrors is returned and all
+// remaining fields are still assigned.
+func BindValues(values url.Values, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected pointer to struct, got %T", dest)
+	}
+	errs := make(BindErrors)
+	bindStruct(values, "", v.Elem(), errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func bindStruct(values url.Values, prefix string, s reflect.Value, errs BindErrors) {
+	tp := s.Type()
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		name := strings.Split(tp.Field(i).Tag.Get("form"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(envconf.Underscore(tp.Field(i).Name))
+		}
+		bindField(values, prefix+name, f, errs)
+	}
+}
+
+func bindField(values url.Values, name string, f reflect.Value, errs BindErrors) {
+	switch {
+	case f.Kind() == reflect.Ptr:
+		if !hasValues(values, name, f.Type().Elem()) {
+			return
+		}
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		bindField(values, name, f.Elem(), errs)
+	case f.Kind() == reflect.Struct && f.Type() != timeType:
+		bindStruct(values, name+".", f, errs)
+	case f.Kind() == reflect.Slice:
+		raw, ok := values[name]
+		if !ok {
+			return
+		}
+		slice := reflect.MakeSlice(f.Type(), 0, len(raw))
+		for _, s := range raw {
+			el := reflect.New(f.Type().Elem()).Elem()
+			if err := envconf.SetValue(el, s); err != nil {
+				bindErr(errs, name, el, err)
+				return
+			}
+			slice = reflect.Append(slice, el)
+		}
+		f.Set(slice)
+	default:
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			return
+		}
+		if err := envconf.SetValue(f, raw[0]); err != nil {
+			bindErr(errs, name, f, err)
+		}
+	}
+}
+
+// hasValues return true if any value that can be assigned to given type was
+// provided.
+func hasValues(values url.Values, name string, tp reflect.Type) bool {
+	if tp.Kind() != reflect.Struct || tp == timeType {
+		_, ok := values[name]
+		return ok
+	}
+	for key := range values {
+		if strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func bindErr(errs BindErrors, name string, v reflect.Value, err error) {
+	if err == envconf.ErrUnsupported {
+		log.Printf("cannot bind %q: unsupported type: %s", name, v.Type())
+		return
+	}
+	switch v.Type() {
+	case timeType:
+		errs[name] = "Invalid date"
+		return
+	case durationType:
+		errs[name] = "Invalid duration"
+		return
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		errs[name] = "Must be an integer"
+	case reflect.Float32, reflect.Float64:
+		errs[name] = "Must be a number"
+	case reflect.Bool:
+		errs[name] = "Must be true or false"
+	default:
+		errs[name] = "Invalid value"
+	}
+}
+
+// BindErrors maps field names to the description of the problem with value
+// provided for it.
+type BindErrors map[string]string
+
+func (e BindErrors) Error() string {
+	switch n := len(e); n {
+	case 0:
+		return ""
+	case 1:
+		return "1 bind error"
+	default:
+		return fmt.Sprintf("%d bind errors", n)
+	}
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
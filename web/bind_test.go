@@ -0,0 +1,163 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBindValues(t *testing.T) {
+	type address struct {
+		Street string
+		Number int
+	}
+	var dest struct {
+		Name      string
+		Age       int
+		Admin     bool
+		Score     float64
+		Born      time.Time
+		Tags      []string `form:"tag"`
+		IDs       []int64  `form:"id"`
+		Timeout   time.Duration
+		Nick      *string
+		Missing   *int
+		Home      address
+		Work      *address
+		Other     *address
+		Ignored   string `form:"-"`
+		unhandled string
+	}
+	values := url.Values{
+		"name":          {"Bob"},
+		"age":           {"42"},
+		"admin":         {"true"},
+		"score":         {"1.5"},
+		"born":          {"1980-01-02"},
+		"tag":           {"a", "b"},
+		"id":            {"1", "2", "3"},
+		"timeout":       {"2s"},
+		"nick":          {"bobby"},
+		"home.street":   {"Main"},
+		"home.number":   {"7"},
+		"work.street":   {"Side"},
+		"ignored":       {"x"},
+		"unhandled":     {"x"},
+		"other_unknown": {"x"},
+	}
+	if err := BindValues(values, &dest); err != nil {
+		t.Fatalf("cannot bind: %s", err)
+	}
+
+	if dest.Name != "Bob" || dest.Age != 42 || !dest.Admin || dest.Score != 1.5 {
+		t.Errorf("invalid scalar values: %+v", dest)
+	}
+	if !dest.Born.Equal(time.Date(1980, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("invalid born: %s", dest.Born)
+	}
+	if !reflect.DeepEqual(dest.Tags, []string{"a", "b"}) {
+		t.Errorf("invalid tags: %v", dest.Tags)
+	}
+	if !reflect.DeepEqual(dest.IDs, []int64{1, 2, 3}) {
+		t.Errorf("invalid ids: %v", dest.IDs)
+	}
+	if dest.Timeout != 2*time.Second {
+		t.Errorf("invalid timeout: %s", dest.Timeout)
+	}
+	if dest.Nick == nil || *dest.Nick != "bobby" {
+		t.Errorf("invalid nick: %v", dest.Nick)
+	}
+	if dest.Missing != nil {
+		t.Errorf("missing must not be allocated: %v", *dest.Missing)
+	}
+	if dest.Home.Street != "Main" || dest.Home.Number != 7 {
+		t.Errorf("invalid home: %+v", dest.Home)
+	}
+	if dest.Work == nil || dest.Work.Street != "Side" {
+		t.Errorf("invalid work: %+v", dest.Work)
+	}
+	if dest.Other != nil {
+		t.Errorf("other must not be allocated: %+v", dest.Other)
+	}
+	if dest.Ignored != "" || dest.unhandled != "" {
+		t.Errorf("ignored fields were set: %+v", dest)
+	}
+}
+
+func TestBindValuesErrors(t *testing.T) {
+	var dest struct {
+		Age   int
+		Score float64
+		IDs   []int `form:"id"`
+		Born  time.Time
+		Name  string
+	}
+	values := url.Values{
+		"age":   {"x"},
+		"score": {"y"},
+		"id":    {"1", "z"},
+		"born":  {"yesterday"},
+		"name":  {"Bob"},
+	}
+	err := BindValues(values, &dest)
+	errs, ok := err.(BindErrors)
+	if !ok {
+		t.Fatalf("want BindErrors, got %#v", err)
+	}
+	want := BindErrors{
+		"age":   "Must be an integer",
+		"score": "Must be a number",
+		"id":    "Must be an integer",
+		"born":  "Invalid date",
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("want %v, got %v", want, errs)
+	}
+	if dest.Name != "Bob" {
+		t.Errorf("valid fields must be assigned, got %q", dest.Name)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	body := strings.NewReader("name=Bob&age=42")
+	r, err := http.NewRequest("POST", "/?page=3", body)
+	if err != nil {
+		t.Fatalf("cannot create request: %s", err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var form struct {
+		Name string
+		Age  int
+	}
+	if err := BindForm(r, &form); err != nil {
+		t.Fatalf("cannot bind form: %s", err)
+	}
+	if form.Name != "Bob" || form.Age != 42 {
+		t.Errorf("invalid form: %+v", form)
+	}
+
+	var query struct {
+		Page int
+	}
+	if err := BindQuery(r, &query); err != nil {
+		t.Fatalf("cannot bind query: %s", err)
+	}
+	if query.Page != 3 {
+		t.Errorf("invalid query: %+v", query)
+	}
+}
+
+func TestBindInvalidDest(t *testing.T) {
+	var n int
+	if err := BindValues(url.Values{}, &n); err == nil {
+		t.Error("expected error")
+	}
+	var s struct{}
+	if err := BindValues(url.Values{}, s); err == nil {
+		t.Error("expected error")
+	}
+}
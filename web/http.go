@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"golang.org/x/net/context"
+
+	"github.com/husio/x/errors"
 )
 
 // JSONResp write content as JSON encoded response.
@@ -59,6 +61,31 @@ func StdJSONResp(w http.ResponseWriter, code int) {
 	}
 }
 
+// ErrStatus return HTTP status code for given error, depending on its kind,
+// see github.com/husio/x/errors. Errors of unknown kind are internal server
+// errors.
+func ErrStatus(err error) int {
+	switch errors.KindOf(err) {
+	case errors.NotFound:
+		return http.StatusNotFound
+	case errors.Conflict:
+		return http.StatusConflict
+	case errors.Invalid:
+		return http.StatusBadRequest
+	case errors.Unauthorized:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// StdJSONErr write JSON encoded, standard HTTP response text for the status
+// code of given error, see ErrStatus. Error message is not written, because
+// it may contain internal details.
+func StdJSONErr(w http.ResponseWriter, err error) {
+	StdJSONResp(w, ErrStatus(err))
+}
+
 // JSONRedirect return redirect response, but with JSON formatted body.
 func JSONRedirect(w http.ResponseWriter, urlStr string, code int) {
 	w.Header().Set("Location", urlStr)
@@ -84,6 +111,12 @@ func StdHTMLResp(w http.ResponseWriter, code int) {
 	render(w, "std-html-response", resp)
 }
 
+// StdHTMLErr write standard HTTP response page for the status code of given
+// error, see ErrStatus.
+func StdHTMLErr(w http.ResponseWriter, err error) {
+	StdHTMLResp(w, ErrStatus(err))
+}
+
 func HTMLErr(w http.ResponseWriter, errText string, code int) {
 	content := struct {
 		Code int
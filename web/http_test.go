@@ -0,0 +1,37 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/husio/x/errors"
+)
+
+func TestErrStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{errors.New(errors.NotFound, "no user"), http.StatusNotFound},
+		{errors.Wrap(errors.New(errors.Conflict, "taken"), "cannot create"), http.StatusConflict},
+		{errors.New(errors.Invalid, "bad email"), http.StatusBadRequest},
+		{errors.WithKind(fmt.Errorf("no token"), errors.Unauthorized), http.StatusUnauthorized},
+		{fmt.Errorf("failed"), http.StatusInternalServerError},
+	}
+	for i, tc := range cases {
+		if got := ErrStatus(tc.err); got != tc.want {
+			t.Errorf("%d: want %d, got %d", i, tc.want, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	StdJSONErr(w, errors.New(errors.NotFound, "secret details"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("want 404, got %d", w.Code)
+	}
+	if body := w.Body.String(); body != "{\n\t\"Code\": 404,\n\t\"errors\": [\n\t\t\"Not Found\"\n\t]\n}" {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
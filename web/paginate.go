@@ -0,0 +1,290 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/husio/x/storage/qb"
+)
+
+// PageOpts defines limits used when parsing page parameters.
+type PageOpts struct {
+	// DefaultLimit is used when request does not provide limit. Defaults
+	// to 20.
+	DefaultLimit int64
+	// MaxLimit is the biggest limit client is allowed to request. Defaults
+	// to 100.
+	MaxLimit int64
+}
+
+// Page describes slice of list results requested by the client.
+//
+// Offset pagination is controlled by "limit" and either "offset" or 1-based
+// "page" query parameters. Keyset pagination is controlled by "limit" and one
+// of "after" or "before" parameters, both holding opaque cursor value
+// generated by PageResp.
+type Page struct {
+	Limit  int64
+	Offset int64
+	// After holds keyset values of the last item of previous page.
+	After []interface{}
+	// Before holds keyset values of the first item of next page.
+	Before []interface{}
+
+	keyset *Keyset
+}
+
+// Keyset defines ordering used by cursor based pagination. Ordering columns
+// combined must be unique, so usually last column is the primary key.
+type Keyset struct {
+	// Columns is the list of columns results are ordered by.
+	Columns []string
+	// Desc is true if results are returned in descending order.
+	Desc bool
+	// Values must return the values of ordering columns for given item, in
+	// the same order as columns are declared.
+	Values func(item interface{}) []interface{}
+}
+
+// UnknownTotal can be passed to PageResp if total count is not known.
+const UnknownTotal = -1
+
+// ParsePage return page information extracted from request query.
+func ParsePage(r *http.Request, o *PageOpts) (*Page, error) {
+	if o == nil {
+		o = &PageOpts{}
+	}
+	p := &Page{Limit: o.DefaultLimit}
+	if p.Limit <= 0 {
+		p.Limit = 20
+	}
+	maxLimit := o.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = 100
+	}
+
+	query := r.URL.Query()
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit: %q", raw)
+		}
+		p.Limit = n
+	}
+	if p.Limit > maxLimit {
+		p.Limit = maxLimit
+	}
+
+	if raw := query.Get("offset"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid offset: %q", raw)
+		}
+		p.Offset = n
+	} else if raw := query.Get("page"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid page: %q", raw)
+		}
+		p.Offset = (n - 1) * p.Limit
+	}
+
+	var err error
+	if raw := query.Get("after"); raw != "" {
+		if p.After, err = decodeCursor(raw); err != nil {
+			return nil, fmt.Errorf("invalid after cursor: %s", err)
+		}
+	}
+	if raw := query.Get("before"); raw != "" {
+		if p.Before, err = decodeCursor(raw); err != nil {
+			return nil, fmt.Errorf("invalid before cursor: %s", err)
+		}
+	}
+	if p.After != nil && p.Before != nil {
+		return nil, fmt.Errorf("after and before cursors cannot be used together")
+	}
+	return p, nil
+}
+
+// Apply set limit and offset of given query. One more than requested row is
+// queried to allow PageResp to determine if next page exists.
+func (p *Page) Apply(q qb.Query) qb.Query {
+	return q.Limit(p.Limit+1, p.Offset)
+}
+
+// ApplyKeyset set keyset condition, ordering and limit of given query. Unlike
+// OFFSET, keyset condition can use index, so the cost of fetching a page does
+// not grow with its position.
+//
+// Offset is ignored when using keyset pagination.
+func (p *Page) ApplyKeyset(q qb.Query, ks *Keyset) (qb.Query, error) {
+	cursor := p.After
+	if p.Before != nil {
+		cursor = p.Before
+	}
+	if cursor != nil && len(cursor) != len(ks.Columns) {
+		return nil, fmt.Errorf("cursor has %d values, expected %d", len(cursor), len(ks.Columns))
+	}
+	p.keyset = ks
+
+	// when paging backward, results are fetched in reversed order and
+	// flipped back by PageResp
+	desc := ks.Desc
+	if p.Before != nil {
+		desc = !desc
+	}
+
+	if cursor != nil {
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(cursor)), ", ")
+		cond := fmt.Sprintf("(%s) %s (%s)", strings.Join(ks.Columns, ", "), op, marks)
+		q = q.Where(cond, cursor...)
+	}
+
+	order := make([]string, len(ks.Columns))
+	for i, c := range ks.Columns {
+		if desc {
+			order[i] = c + " DESC"
+		} else {
+			order[i] = c + " ASC"
+		}
+	}
+	return q.OrderBy(strings.Join(order, ", ")).Limit(p.Limit+1, 0), nil
+}
+
+// PageResp write JSON encoded list response with navigation links. Items must
+// be a slice fetched using query with page applied. Links to next and previous
+// pages are included in the body and in the Link header (RFC 5988). Total count
+// is included only if not negative.
+func PageResp(w http.ResponseWriter, r *http.Request, p *Page, items interface{}, total int64) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		panic(fmt.Sprintf("items must be a slice, got %T", items))
+	}
+
+	var next, prev url.Values
+	hasMore := int64(v.Len()) > p.Limit
+	if hasMore {
+		v = v.Slice(0, int(p.Limit))
+	}
+
+	if p.keyset == nil {
+		if hasMore {
+			next = url.Values{"offset": {fmtInt(p.Offset + p.Limit)}}
+		}
+		if p.Offset > 0 {
+			offset := p.Offset - p.Limit
+			if offset < 0 {
+				offset = 0
+			}
+			prev = url.Values{"offset": {fmtInt(offset)}}
+		}
+	} else {
+		if p.Before != nil {
+			v = reversed(v)
+		}
+		if n := v.Len(); n > 0 {
+			first := p.keyset.Values(v.Index(0).Interface())
+			last := p.keyset.Values(v.Index(n - 1).Interface())
+			if p.Before == nil && hasMore || p.Before != nil {
+				next = url.Values{"after": {encodeCursor(last)}}
+			}
+			if p.After != nil || p.Before != nil && hasMore {
+				prev = url.Values{"before": {encodeCursor(first)}}
+			}
+		}
+	}
+
+	resp := struct {
+		Items interface{} `json:"items"`
+		Next  string      `json:"next,omitempty"`
+		Prev  string      `json:"prev,omitempty"`
+		Total *int64      `json:"total,omitempty"`
+	}{
+		Items: v.Interface(),
+	}
+	if v.Len() == 0 {
+		resp.Items = []struct{}{}
+	}
+	if total >= 0 {
+		resp.Total = &total
+	}
+
+	var links []string
+	if next != nil {
+		resp.Next = pageURL(r.URL, p.Limit, next)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, resp.Next))
+	}
+	if prev != nil {
+		resp.Prev = pageURL(r.URL, p.Limit, prev)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, resp.Prev))
+	}
+	if len(links) != 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	JSONResp(w, resp, http.StatusOK)
+}
+
+// pageURL return copy of given URL with all page parameters replaced.
+func pageURL(u *url.URL, limit int64, params url.Values) string {
+	query := u.Query()
+	for _, name := range []string{"page", "offset", "after", "before"} {
+		query.Del(name)
+	}
+	query.Set("limit", fmtInt(limit))
+	for name, values := range params {
+		query[name] = values
+	}
+	res := *u
+	res.RawQuery = query.Encode()
+	return res.String()
+}
+
+func reversed(v reflect.Value) reflect.Value {
+	n := v.Len()
+	res := reflect.MakeSlice(v.Type(), n, n)
+	for i := 0; i < n; i++ {
+		res.Index(n - 1 - i).Set(v.Index(i))
+	}
+	return res
+}
+
+func encodeCursor(values []interface{}) string {
+	b, err := json.Marshal(values)
+	if err != nil {
+		panic(fmt.Sprintf("cannot encode cursor: %s", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	// keep numbers as json.Number to not lose precision of big integers
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var values []interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty cursor")
+	}
+	return values, nil
+}
+
+func fmtInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,206 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/husio/x/storage/qb"
+)
+
+func TestParsePage(t *testing.T) {
+	cases := map[string]struct {
+		query   string
+		want    Page
+		wantErr bool
+	}{
+		"defaults": {
+			query: "",
+			want:  Page{Limit: 20},
+		},
+		"offset": {
+			query: "limit=10&offset=30",
+			want:  Page{Limit: 10, Offset: 30},
+		},
+		"page": {
+			query: "limit=10&page=3",
+			want:  Page{Limit: 10, Offset: 20},
+		},
+		"max_limit": {
+			query: "limit=1000",
+			want:  Page{Limit: 100},
+		},
+		"after": {
+			query: "after=" + encodeCursor([]interface{}{"x", 2}),
+			want:  Page{Limit: 20, After: []interface{}{"x", json.Number("2")}},
+		},
+		"invalid_limit": {
+			query:   "limit=0",
+			wantErr: true,
+		},
+		"invalid_page": {
+			query:   "page=x",
+			wantErr: true,
+		},
+		"invalid_cursor": {
+			query:   "before=!!!",
+			wantErr: true,
+		},
+		"both_cursors": {
+			query:   "before=WzFd&after=WzFd",
+			wantErr: true,
+		},
+	}
+
+	for tname, tc := range cases {
+		r, _ := http.NewRequest("GET", "/items?"+tc.query, nil)
+		p, err := ParsePage(r, nil)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error", tname)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tname, err)
+			continue
+		}
+		if !reflect.DeepEqual(*p, tc.want) {
+			t.Errorf("%s: want %+v, got %+v", tname, tc.want, *p)
+		}
+	}
+}
+
+func TestPageOffset(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/items?limit=2&page=2&color=red", nil)
+	p, err := ParsePage(r, nil)
+	if err != nil {
+		t.Fatalf("cannot parse page: %s", err)
+	}
+
+	q := p.Apply(qb.Q("SELECT * FROM items"))
+	if _, args := q.Build(); !reflect.DeepEqual(args, []interface{}{int64(3), int64(2)}) {
+		t.Errorf("invalid query args: %v", args)
+	}
+
+	w := httptest.NewRecorder()
+	PageResp(w, r, p, []int{3, 4, 5}, 10)
+
+	var resp struct {
+		Items []int
+		Next  string
+		Prev  string
+		Total *int64
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot decode response: %s", err)
+	}
+	if !reflect.DeepEqual(resp.Items, []int{3, 4}) {
+		t.Errorf("invalid items: %v", resp.Items)
+	}
+	if resp.Total == nil || *resp.Total != 10 {
+		t.Errorf("invalid total: %v", resp.Total)
+	}
+	if want := "/items?color=red&limit=2&offset=4"; resp.Next != want {
+		t.Errorf("want next %q, got %q", want, resp.Next)
+	}
+	if want := "/items?color=red&limit=2&offset=0"; resp.Prev != want {
+		t.Errorf("want prev %q, got %q", want, resp.Prev)
+	}
+	wantLink := `</items?color=red&limit=2&offset=4>; rel="next", </items?color=red&limit=2&offset=0>; rel="prev"`
+	if got := w.Header().Get("Link"); got != wantLink {
+		t.Errorf("want link %q, got %q", wantLink, got)
+	}
+}
+
+func TestPageKeyset(t *testing.T) {
+	type item struct {
+		ID int64
+	}
+	ks := &Keyset{
+		Columns: []string{"id"},
+		Desc:    true,
+		Values: func(it interface{}) []interface{} {
+			return []interface{}{it.(item).ID}
+		},
+	}
+
+	// first page
+	r, _ := http.NewRequest("GET", "/items?limit=2", nil)
+	p, _ := ParsePage(r, nil)
+	q, err := p.ApplyKeyset(qb.Q("SELECT * FROM items"), ks)
+	if err != nil {
+		t.Fatalf("cannot apply keyset: %s", err)
+	}
+	if want := "SELECT * FROM items ORDER BY id DESC LIMIT ?"; q.String() != want {
+		t.Errorf("want %q, got %q", want, q.String())
+	}
+	w := httptest.NewRecorder()
+	PageResp(w, r, p, []item{{9}, {8}, {7}}, UnknownTotal)
+	next, prev := pageLinks(t, w)
+	if prev != "" {
+		t.Errorf("first page must not have prev link: %s", prev)
+	}
+
+	// second page, using next link
+	r, _ = http.NewRequest("GET", next, nil)
+	p, _ = ParsePage(r, nil)
+	q, _ = p.ApplyKeyset(qb.Q("SELECT * FROM items"), ks)
+	if want := "SELECT * FROM items WHERE ((id) < (?)) ORDER BY id DESC LIMIT ?"; q.String() != want {
+		t.Errorf("want %q, got %q", want, q.String())
+	}
+	if _, args := q.Build(); !reflect.DeepEqual(args, []interface{}{json.Number("8"), int64(3)}) {
+		t.Errorf("invalid args: %#v", args)
+	}
+	w = httptest.NewRecorder()
+	PageResp(w, r, p, []item{{7}, {6}}, UnknownTotal)
+	next, prev = pageLinks(t, w)
+	if next != "" {
+		t.Errorf("last page must not have next link: %s", next)
+	}
+
+	// back to the first page, using prev link
+	r, _ = http.NewRequest("GET", prev, nil)
+	p, _ = ParsePage(r, nil)
+	q, _ = p.ApplyKeyset(qb.Q("SELECT * FROM items"), ks)
+	if want := "SELECT * FROM items WHERE ((id) > (?)) ORDER BY id ASC LIMIT ?"; q.String() != want {
+		t.Errorf("want %q, got %q", want, q.String())
+	}
+	w = httptest.NewRecorder()
+	PageResp(w, r, p, []item{{8}, {9}}, UnknownTotal)
+	var resp struct {
+		Items []item
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot decode response: %s", err)
+	}
+	if !reflect.DeepEqual(resp.Items, []item{{9}, {8}}) {
+		t.Errorf("invalid items: %v", resp.Items)
+	}
+	next, prev = pageLinks(t, w)
+	if next == "" || prev != "" {
+		t.Errorf("want only next link, got %q and %q", next, prev)
+	}
+}
+
+func pageLinks(t *testing.T, w *httptest.ResponseRecorder) (string, string) {
+	var resp struct {
+		Next string
+		Prev string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot decode response: %s", err)
+	}
+	for _, raw := range []string{resp.Next, resp.Prev} {
+		if raw == "" {
+			continue
+		}
+		if _, err := url.Parse(raw); err != nil {
+			t.Fatalf("invalid link %q: %s", raw, err)
+		}
+	}
+	return resp.Next, resp.Prev
+}
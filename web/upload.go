@@ -0,0 +1,307 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// UploadOpts defines how multipart upload is received.
+type UploadOpts struct {
+	// Sink is used to store content of every received file. Required.
+	Sink UploadSink
+	// MaxFileSize is the size limit in bytes for a single file. Defaults to
+	// 10MB.
+	MaxFileSize int64
+	// MaxTotalSize is the size limit in bytes for all parts of the request
+	// together, including non file fields. Defaults to 32MB.
+	MaxTotalSize int64
+	// MaxFiles is the maximum number of files accepted in single request.
+	// Zero means no limit.
+	MaxFiles int
+	// AllowedTypes is the whitelist of content types, as detected by
+	// inspecting the beginning of the file. Wildcard subtype such as
+	// "image/*" is allowed. When empty, any type is accepted.
+	AllowedTypes []string
+}
+
+// Upload is the result of processing multipart request.
+type Upload struct {
+	Files  []*UploadedFile
+	Values url.Values
+}
+
+// UploadedFile describes single file stored by the sink.
+type UploadedFile struct {
+	// Field is the name of the form field the file was sent with.
+	Field string
+	// Filename is the file name as provided by the client.
+	Filename string
+	// ContentType is the sniffed content type of the file.
+	ContentType string
+	// Size is the number of bytes written.
+	Size int64
+	// SHA256 is hex encoded checksum of the file content.
+	SHA256 string
+	// Path is set by TempDirSink to the location of the stored file.
+	Path string
+}
+
+// UploadSink is the storage for uploaded files.
+type UploadSink interface {
+	// Create return writer that file content will be streamed to. Writer is
+	// always closed, even if the upload failed.
+	Create(f *UploadedFile) (io.WriteCloser, error)
+	// Remove is called for every created file when the upload failed.
+	Remove(f *UploadedFile) error
+}
+
+// TempDirSink return sink that store every file as temporary file inside of
+// given directory. Use os.TempDir for the system default.
+func TempDirSink(dir string) UploadSink {
+	return tempDirSink(dir)
+}
+
+type tempDirSink string
+
+func (dir tempDirSink) Create(f *UploadedFile) (io.WriteCloser, error) {
+	fd, err := ioutil.TempFile(string(dir), "upload-")
+	if err != nil {
+		return nil, err
+	}
+	f.Path = fd.Name()
+	return fd, nil
+}
+
+func (dir tempDirSink) Remove(f *UploadedFile) error {
+	if f.Path == "" {
+		return nil
+	}
+	return os.Remove(f.Path)
+}
+
+// WriterSink return sink that is using given function to create destination
+// writer for every uploaded file. If returned writer implements io.Closer, it
+// is closed once all file content is written.
+func WriterSink(create func(*UploadedFile) (io.Writer, error)) UploadSink {
+	return writerSink(create)
+}
+
+type writerSink func(*UploadedFile) (io.Writer, error)
+
+func (fn writerSink) Create(f *UploadedFile) (io.WriteCloser, error) {
+	w, err := fn(f)
+	if err != nil {
+		return nil, err
+	}
+	if wc, ok := w.(io.WriteCloser); ok {
+		return wc, nil
+	}
+	return nopCloser{w}, nil
+}
+
+func (writerSink) Remove(*UploadedFile) error {
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ReceiveUpload stream all parts of multipart request body. Files are written
+// to the sink configured by options, other form fields are returned as
+// values.
+//
+// If any of the limits is exceeded, or file type is not allowed, all already
+// stored files are removed, JSON error response is written and false
+// returned.
+func ReceiveUpload(w http.ResponseWriter, r *http.Request, o *UploadOpts) (*Upload, bool) {
+	u := &Upload{Values: make(url.Values)}
+	if err := receiveUpload(r, o, u); err != nil {
+		for _, f := range u.Files {
+			if err := o.Sink.Remove(f); err != nil {
+				log.Printf("cannot remove uploaded %q file: %s", f.Filename, err)
+			}
+		}
+		if err, ok := err.(*uploadErr); ok {
+			JSONErr(w, err.text, err.code)
+		} else {
+			log.Printf("cannot receive upload: %s", err)
+			StdJSONResp(w, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return u, true
+}
+
+type uploadErr struct {
+	text string
+	code int
+}
+
+func (e *uploadErr) Error() string {
+	return e.text
+}
+
+func receiveUpload(r *http.Request, o *UploadOpts, u *Upload) error {
+	maxFile := o.MaxFileSize
+	if maxFile <= 0 {
+		maxFile = 10 << 20
+	}
+	remaining := o.MaxTotalSize
+	if remaining <= 0 {
+		remaining = 32 << 20
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return &uploadErr{"Expected multipart/form-data", http.StatusUnsupportedMediaType}
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &uploadErr{"Malformed multipart body", http.StatusBadRequest}
+		}
+
+		if part.FileName() == "" {
+			var b bytes.Buffer
+			n, err := io.Copy(&b, io.LimitReader(part, remaining+1))
+			part.Close()
+			if err != nil {
+				return &uploadErr{"Malformed multipart body", http.StatusBadRequest}
+			}
+			if remaining -= n; remaining < 0 {
+				return &uploadErr{"Request body too large", http.StatusRequestEntityTooLarge}
+			}
+			u.Values.Add(part.FormName(), b.String())
+			continue
+		}
+
+		if o.MaxFiles > 0 && len(u.Files) >= o.MaxFiles {
+			return &uploadErr{
+				fmt.Sprintf("Too many files, at most %d allowed", o.MaxFiles),
+				http.StatusRequestEntityTooLarge,
+			}
+		}
+
+		f := &UploadedFile{
+			Field:    part.FormName(),
+			Filename: part.FileName(),
+		}
+		n, err := receiveFile(part, f, o, maxFile, remaining, &u.Files)
+		part.Close()
+		if err != nil {
+			return err
+		}
+		remaining -= n
+	}
+}
+
+func receiveFile(
+	part io.Reader,
+	f *UploadedFile,
+	o *UploadOpts,
+	maxFile int64,
+	remaining int64,
+	files *[]*UploadedFile,
+) (int64, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, &uploadErr{"Malformed multipart body", http.StatusBadRequest}
+	}
+	head = head[:n]
+
+	f.ContentType = http.DetectContentType(head)
+	if !typeAllowed(o.AllowedTypes, f.ContentType) {
+		return 0, &uploadErr{
+			fmt.Sprintf("File %q type %s is not allowed", f.Filename, f.ContentType),
+			http.StatusUnsupportedMediaType,
+		}
+	}
+
+	dest, err := o.Sink.Create(f)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create %q file: %s", f.Filename, err)
+	}
+	// file must be registered as soon as it was created, so that it can be
+	// removed in case of any failure
+	*files = append(*files, f)
+
+	limit := maxFile
+	if remaining < limit {
+		limit = remaining
+	}
+	sum := sha256.New()
+	cw := &countWriter{hash: sum}
+	src := io.MultiReader(bytes.NewReader(head), part)
+	_, err = io.Copy(io.MultiWriter(dest, cw), io.LimitReader(src, limit+1))
+	if cerr := dest.Close(); err == nil && cerr != nil {
+		return cw.n, fmt.Errorf("cannot close %q file: %s", f.Filename, cerr)
+	}
+	if err != nil {
+		return cw.n, fmt.Errorf("cannot write %q file: %s", f.Filename, err)
+	}
+
+	if cw.n > maxFile {
+		return cw.n, &uploadErr{
+			fmt.Sprintf("File %q exceeds %d bytes limit", f.Filename, maxFile),
+			http.StatusRequestEntityTooLarge,
+		}
+	}
+	if cw.n > remaining {
+		return cw.n, &uploadErr{"Request body too large", http.StatusRequestEntityTooLarge}
+	}
+
+	f.Size = cw.n
+	f.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return cw.n, nil
+}
+
+// countWriter compute checksum and count all bytes written.
+type countWriter struct {
+	n    int64
+	hash hash.Hash
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return w.hash.Write(b)
+}
+
+func typeAllowed(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == mediaType {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+func TestReceiveUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := append(pngHeader, bytes.Repeat([]byte{1}, 2000)...)
+	r := uploadRequest(t, map[string]string{"title": "my image"}, map[string][]byte{
+		"image.png": img,
+	})
+	w := httptest.NewRecorder()
+	u, ok := ReceiveUpload(w, r, &UploadOpts{
+		Sink:         TempDirSink(dir),
+		AllowedTypes: []string{"image/*"},
+	})
+	if !ok {
+		t.Fatalf("upload failed: %d %s", w.Code, w.Body)
+	}
+	if got := u.Values.Get("title"); got != "my image" {
+		t.Errorf("want title value, got %q", got)
+	}
+	if len(u.Files) != 1 {
+		t.Fatalf("want one file, got %d", len(u.Files))
+	}
+	f := u.Files[0]
+	if f.Filename != "image.png" || f.Field != "file" || f.ContentType != "image/png" {
+		t.Errorf("invalid file: %+v", f)
+	}
+	if f.Size != int64(len(img)) {
+		t.Errorf("want size %d, got %d", len(img), f.Size)
+	}
+	sum := sha256.Sum256(img)
+	if want := hex.EncodeToString(sum[:]); f.SHA256 != want {
+		t.Errorf("want checksum %s, got %s", want, f.SHA256)
+	}
+	if b, err := ioutil.ReadFile(f.Path); err != nil {
+		t.Errorf("cannot read stored file: %s", err)
+	} else if !bytes.Equal(b, img) {
+		t.Error("stored file content is different")
+	}
+}
+
+func TestReceiveUploadLimits(t *testing.T) {
+	cases := map[string]struct {
+		files    map[string][]byte
+		opts     UploadOpts
+		wantCode int
+	}{
+		"file_too_big": {
+			files:    map[string][]byte{"a.txt": bytes.Repeat([]byte("a"), 101)},
+			opts:     UploadOpts{MaxFileSize: 100},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		"total_too_big": {
+			files: map[string][]byte{
+				"a.txt": bytes.Repeat([]byte("a"), 80),
+				"b.txt": bytes.Repeat([]byte("b"), 80),
+			},
+			opts:     UploadOpts{MaxFileSize: 100, MaxTotalSize: 150},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		"too_many_files": {
+			files: map[string][]byte{
+				"a.txt": []byte("a"),
+				"b.txt": []byte("b"),
+			},
+			opts:     UploadOpts{MaxFiles: 1},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		"type_not_allowed": {
+			files:    map[string][]byte{"a.png": []byte("plain text")},
+			opts:     UploadOpts{AllowedTypes: []string{"image/png"}},
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for tname, tc := range cases {
+		var created, removed int
+		tc.opts.Sink = &countingSink{created: &created, removed: &removed}
+
+		r := uploadRequest(t, nil, tc.files)
+		w := httptest.NewRecorder()
+		if _, ok := ReceiveUpload(w, r, &tc.opts); ok {
+			t.Errorf("%s: want failure", tname)
+			continue
+		}
+		if w.Code != tc.wantCode {
+			t.Errorf("%s: want %d, got %d", tname, tc.wantCode, w.Code)
+		}
+		var resp struct {
+			Errors []string `json:"errors"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Errors) != 1 {
+			t.Errorf("%s: invalid error response: %s", tname, w.Body)
+		}
+		if created != removed {
+			t.Errorf("%s: created %d files, removed %d", tname, created, removed)
+		}
+	}
+}
+
+func TestReceiveUploadNotMultipart(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/", strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	if _, ok := ReceiveUpload(w, r, &UploadOpts{Sink: TempDirSink(os.TempDir())}); ok {
+		t.Fatal("want failure")
+	}
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("want 415, got %d", w.Code)
+	}
+}
+
+type countingSink struct {
+	created *int
+	removed *int
+}
+
+func (s *countingSink) Create(f *UploadedFile) (io.WriteCloser, error) {
+	*s.created++
+	return nopCloser{ioutil.Discard}, nil
+}
+
+func (s *countingSink) Remove(f *UploadedFile) error {
+	*s.removed++
+	return nil
+}
+
+func uploadRequest(t *testing.T, values map[string]string, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range values {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatalf("cannot write field: %s", err)
+		}
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("cannot create file: %s", err)
+		}
+		if _, err := fw.Write(content); err != nil {
+			t.Fatalf("cannot write file: %s", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("cannot close multipart writer: %s", err)
+	}
+
+	r, err := http.NewRequest("POST", "/upload", &body)
+	if err != nil {
+		t.Fatalf("cannot create request: %s", err)
+	}
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
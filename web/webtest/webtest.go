@@ -0,0 +1,282 @@
+// Package webtest provides helpers for testing HTTP handlers.
+//
+// Request is built together with the context that handler is called with,
+// and the response returned by the call provides chainable assertions:
+//
+//	webtest.NewRequest(t, "GET", "/users/42", nil).
+//		WithDB(db).
+//		WithArgs("id", "42").
+//		Call(UserHandler).
+//		Status(http.StatusOK).
+//		JSON("name", "Bob")
+package webtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+	"github.com/husio/x/stamp"
+	"github.com/husio/x/storage/pgtest"
+	"github.com/husio/x/web"
+)
+
+// Request is HTTP request together with the context it is handled with.
+type Request struct {
+	t   testing.TB
+	ctx context.Context
+	r   *http.Request
+}
+
+// NewRequest return request with empty context. Test fails if request cannot
+// be created.
+func NewRequest(t testing.TB, method, urlStr string, body io.Reader) *Request {
+	t.Helper()
+	r, err := http.NewRequest(method, urlStr, body)
+	if err != nil {
+		t.Fatalf("cannot create %s %s request: %s", method, urlStr, err)
+	}
+	return &Request{
+		t:   t,
+		ctx: context.Background(),
+		r:   r,
+	}
+}
+
+// NewJSONRequest return request with given content JSON encoded as the body.
+func NewJSONRequest(t testing.TB, method, urlStr string, content interface{}) *Request {
+	t.Helper()
+	b, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("cannot JSON encode request body: %s", err)
+	}
+	req := NewRequest(t, method, urlStr, bytes.NewReader(b))
+	req.r.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// NewFormRequest return request with given values URL encoded as the body.
+func NewFormRequest(t testing.TB, method, urlStr string, values url.Values) *Request {
+	t.Helper()
+	req := NewRequest(t, method, urlStr, strings.NewReader(values.Encode()))
+	req.r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+// HTTPRequest return underlying HTTP request.
+func (req *Request) HTTPRequest() *http.Request {
+	return req.r
+}
+
+// Context return context the handler is called with.
+func (req *Request) Context() context.Context {
+	return req.ctx
+}
+
+// WithValue set context value.
+func (req *Request) WithValue(key, value interface{}) *Request {
+	req.ctx = context.WithValue(req.ctx, key, value)
+	return req
+}
+
+// WithDB set database mock, that is returned by pg.DB.
+func (req *Request) WithDB(db *pgtest.DB) *Request {
+	if db.Fatalf == nil {
+		db.Fatalf = req.t.Fatalf
+	}
+	req.ctx = pgtest.WithDB(req.ctx, db)
+	return req
+}
+
+// WithCache set cache instance, that is returned by cache.Get.
+func (req *Request) WithCache(c cache.Cache) *Request {
+	req.ctx = cache.WithCache(req.ctx, c)
+	return req
+}
+
+// WithVault set vault instance, that is returned by stamp.GetVault.
+func (req *Request) WithVault(v *stamp.Vault) *Request {
+	req.ctx = stamp.WithVault(req.ctx, v)
+	return req
+}
+
+// WithArgs set router arguments, that are returned by web.Args.
+func (req *Request) WithArgs(pairs ...string) *Request {
+	req.ctx = web.WithArgs(req.ctx, pairs...)
+	return req
+}
+
+// WithHeader set request header.
+func (req *Request) WithHeader(name, value string) *Request {
+	req.r.Header.Set(name, value)
+	return req
+}
+
+// WithCookie add cookie to the request.
+func (req *Request) WithCookie(c *http.Cookie) *Request {
+	req.r.AddCookie(c)
+	return req
+}
+
+// Call handle request with given handler.
+func (req *Request) Call(fn web.HandlerFunc) *Response {
+	w := httptest.NewRecorder()
+	fn(req.ctx, w, req.r)
+	return &Response{t: req.t, rec: w}
+}
+
+// Serve handle request with given router.
+func (req *Request) Serve(rt *web.Router) *Response {
+	w := httptest.NewRecorder()
+	rt.ServeCtxHTTP(req.ctx, w, req.r)
+	return &Response{t: req.t, rec: w}
+}
+
+// Response is recorded handler response. All assertion methods report
+// failure using Errorf, so all of them are checked.
+type Response struct {
+	t   testing.TB
+	rec *httptest.ResponseRecorder
+}
+
+// Recorder return underlying response recorder.
+func (resp *Response) Recorder() *httptest.ResponseRecorder {
+	return resp.rec
+}
+
+// Body return response body.
+func (resp *Response) Body() []byte {
+	return resp.rec.Body.Bytes()
+}
+
+// DecodeJSON unmarshal response body into dest. Test fails if body is not
+// valid JSON.
+func (resp *Response) DecodeJSON(dest interface{}) *Response {
+	resp.t.Helper()
+	if err := json.Unmarshal(resp.rec.Body.Bytes(), dest); err != nil {
+		resp.t.Fatalf("cannot decode JSON response: %s\n%s", err, resp.rec.Body)
+	}
+	return resp
+}
+
+// Status assert response status code.
+func (resp *Response) Status(code int) *Response {
+	resp.t.Helper()
+	if resp.rec.Code != code {
+		resp.t.Errorf("want %d status, got %d\n%s", code, resp.rec.Code, resp.rec.Body)
+	}
+	return resp
+}
+
+// Header assert value of the response header.
+func (resp *Response) Header(name, value string) *Response {
+	resp.t.Helper()
+	if got := resp.rec.Header().Get(name); got != value {
+		resp.t.Errorf("want %q header to be %q, got %q", name, value, got)
+	}
+	return resp
+}
+
+// Redirect assert that response is redirecting to given location.
+func (resp *Response) Redirect(location string) *Response {
+	resp.t.Helper()
+	if resp.rec.Code < 300 || resp.rec.Code >= 400 {
+		resp.t.Errorf("want redirect status, got %d", resp.rec.Code)
+	}
+	if got := resp.rec.Header().Get("Location"); got != location {
+		resp.t.Errorf("want redirect to %q, got %q", location, got)
+	}
+	return resp
+}
+
+// Cookie assert that response is setting cookie with given name and value.
+func (resp *Response) Cookie(name, value string) *Response {
+	resp.t.Helper()
+	c := resp.FindCookie(name)
+	if c == nil {
+		resp.t.Errorf("cookie %q not set", name)
+		return resp
+	}
+	if c.Value != value {
+		resp.t.Errorf("want %q cookie to be %q, got %q", name, value, c.Value)
+	}
+	return resp
+}
+
+// FindCookie return cookie with given name set by the response or nil.
+func (resp *Response) FindCookie(name string) *http.Cookie {
+	r := http.Response{Header: resp.rec.Header()}
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// JSON assert value found under given path of JSON encoded response body.
+// Path is dot separated list of object keys and array indexes, for example
+// "errors.0". Empty path compares the whole body.
+//
+// Expected value is compared after being JSON encoded and decoded, so that
+// numbers and structures can be used directly.
+func (resp *Response) JSON(path string, want interface{}) *Response {
+	resp.t.Helper()
+	var body interface{}
+	if err := json.Unmarshal(resp.rec.Body.Bytes(), &body); err != nil {
+		resp.t.Errorf("cannot decode JSON response: %s\n%s", err, resp.rec.Body)
+		return resp
+	}
+	got, ok := lookup(body, path)
+	if !ok {
+		resp.t.Errorf("%q not found in JSON response\n%s", path, resp.rec.Body)
+		return resp
+	}
+
+	b, err := json.Marshal(want)
+	if err != nil {
+		resp.t.Fatalf("cannot JSON encode expected value: %s", err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		resp.t.Fatalf("cannot JSON decode expected value: %s", err)
+	}
+	if !reflect.DeepEqual(got, normalized) {
+		resp.t.Errorf("want %q to be %s, got %#v", path, b, got)
+	}
+	return resp
+}
+
+func lookup(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, name := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[name]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			n, err := strconv.Atoi(name)
+			if err != nil || n < 0 || n >= len(node) {
+				return nil, false
+			}
+			v = node[n]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
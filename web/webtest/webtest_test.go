@@ -0,0 +1,92 @@
+package webtest
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/husio/x/cache"
+	"github.com/husio/x/internal/testutil"
+	"github.com/husio/x/storage/pg"
+	"github.com/husio/x/storage/pgtest"
+	"github.com/husio/x/web"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func userHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var u user
+	if err := pg.DB(ctx).Get(&u, "SELECT", web.Args(ctx).ByName("name")); err != nil {
+		web.JSONErr(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := cache.Get(ctx).Put("user:"+u.Name, u); err != nil {
+		web.StdJSONResp(w, http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: "seen", Value: u.Name})
+	web.JSONResp(w, struct {
+		User  user
+		Roles []string
+	}{u, []string{"admin", "staff"}}, http.StatusOK)
+}
+
+func TestCall(t *testing.T) {
+	c := cache.Get(cache.WithLocalCache(context.Background(), 10))
+	db := &pgtest.DB{
+		Stack: []pgtest.ResultMock{
+			{Method: "Get", Result: &user{Name: "bob", Age: 42}},
+		},
+	}
+
+	NewRequest(t, "GET", "/users/bob", nil).
+		WithDB(db).
+		WithCache(c).
+		WithArgs("name", "bob").
+		Call(userHandler).
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json; charset=UTF-8").
+		Cookie("seen", "bob").
+		JSON("User.Name", "bob").
+		JSON("User", user{Name: "bob", Age: 42}).
+		JSON("Roles.1", "staff")
+
+	var cached user
+	if err := c.Get("user:bob", &cached); err != nil || cached.Age != 42 {
+		t.Errorf("user not cached: %+v, %v", cached, err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	rt := web.NewRouter(web.Routes{
+		{Path: `/old`, Func: web.RedirectHandler("/new", http.StatusMovedPermanently), Methods: "GET"},
+	})
+	NewRequest(t, "GET", "/old", nil).
+		Serve(rt).
+		Status(http.StatusMovedPermanently).
+		Redirect("/new")
+}
+
+func TestAssertionFailures(t *testing.T) {
+	rt := &testutil.RecordingT{TB: t}
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		web.JSONErr(w, "boom", http.StatusBadRequest)
+	}
+	NewRequest(rt, "GET", "/", nil).
+		Call(h).
+		Status(http.StatusOK).
+		Header("X-Missing", "value").
+		Cookie("missing", "value").
+		Redirect("/").
+		JSON("errors.0", "boom").
+		JSON("errors.0", "other").
+		JSON("errors.1", "boom")
+
+	if errs := rt.Errors(); len(errs) != 7 {
+		t.Errorf("want 7 failures, got %d: %q", len(errs), errs)
+	}
+}